@@ -0,0 +1,294 @@
+/*
+Package intervaltree indexes d-dimensional boxes, such as merged cells or
+formatted ranges of a spreadsheet, and finds the boxes intersecting,
+containing or contained by a query.
+
+Each box is kept as a point of 2d dimensions in a v1 range tree, its low
+and high in dimension i becoming dimensions 2i-1 and 2i.  Every question
+about boxes then becomes an orthogonal range query on those points, so
+inserts, removes and queries cost what they do on the point tree.
+*/
+package intervaltree
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/v1"
+)
+
+/*
+The errors returned by the checked methods of a Tree, match them with
+errors.Is.  A box with the wrong number of dimensions wraps
+rangetree.ErrDimensionMismatch.
+*/
+var (
+	ErrNilBox   = errors.New(`intervaltree: nil box`)
+	ErrEmptyBox = errors.New(`intervaltree: box is empty in a dimension`)
+)
+
+/*
+Box is a region with bounds in each dimension, read with
+rangetree.Inclusive so nil bounds span every value.  It has the same
+shape as a rangetree.Query, any Query that knows its dimensions is a
+Box.  Boxes are told apart with ==, so two boxes with the same bounds are
+both kept and Remove takes out only the one given.  Boxes of a type that
+can't be compared with ==, such as a slice, are told apart by their
+bounds, as rangetree.SameEntry does for entries.
+*/
+type Box interface {
+	r.Query
+	/*
+		The number of dimensions the box spans.
+	*/
+	MaxDimensions() int
+}
+
+/*
+a box as a point, its low and high in each dimension one after the other
+*/
+type entry struct {
+	box    Box
+	values []int
+}
+
+func newEntry(box Box) *entry {
+	values := make([]int, 0, 2*box.MaxDimensions())
+	for dimension := 1; dimension <= box.MaxDimensions(); dimension++ {
+		low, high := r.Inclusive(box.GetDimensionalBounds(dimension))
+		values = append(values, low, high)
+	}
+
+	return &entry{box, values}
+}
+
+func (self *entry) GetDimensionalValue(dimension int) int {
+	return self.values[dimension-1]
+}
+
+func (self *entry) MaxDimensions() int {
+	return len(self.values)
+}
+
+func (self *entry) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+func (self *entry) Equal(other r.Entry) bool {
+	o, ok := other.(*entry)
+	if !ok || reflect.TypeOf(o.box) != reflect.TypeOf(self.box) {
+		return false
+	}
+
+	if !reflect.ValueOf(self.box).Comparable() || !reflect.ValueOf(o.box).Comparable() {
+		return slices.Equal(o.values, self.values)
+	}
+
+	return o.box == self.box
+}
+
+/*
+Tree holds boxes of a fixed number of dimensions.
+*/
+type Tree struct {
+	maxDimensions int
+	points        r.RangeTree
+}
+
+func (self *Tree) entries(boxes []Box) ([]r.Entry, error) {
+	entries := make([]r.Entry, 0, len(boxes))
+	for i, box := range boxes {
+		if box == nil {
+			return nil, fmt.Errorf(`%w: box %d`, ErrNilBox, i)
+		}
+
+		if box.MaxDimensions() != self.maxDimensions {
+			return nil, fmt.Errorf(
+				`%w: box %d has %d dimensions, the tree has %d`,
+				r.ErrDimensionMismatch, i, box.MaxDimensions(), self.maxDimensions,
+			)
+		}
+
+		e := newEntry(box)
+		for j := 0; j < len(e.values); j += 2 {
+			if e.values[j] > e.values[j+1] {
+				return nil, fmt.Errorf(`%w: box %d in dimension %d`, ErrEmptyBox, i, j/2+1)
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+/*
+Inserts the boxes, panics if any of them is invalid.
+*/
+func (self *Tree) Insert(boxes ...Box) {
+	if err := self.InsertChecked(boxes...); err != nil {
+		panic(err)
+	}
+}
+
+/*
+Validates the boxes before inserting any of them.
+*/
+func (self *Tree) InsertChecked(boxes ...Box) error {
+	entries, err := self.entries(boxes)
+	if err != nil {
+		return err
+	}
+
+	self.points.Insert(entries...)
+	return nil
+}
+
+/*
+Removes the boxes, panics if any of them is invalid.  Boxes not in the
+tree are ignored.
+*/
+func (self *Tree) Remove(boxes ...Box) {
+	if err := self.RemoveChecked(boxes...); err != nil {
+		panic(err)
+	}
+}
+
+/*
+Validates the boxes before removing any of them.
+*/
+func (self *Tree) RemoveChecked(boxes ...Box) error {
+	entries, err := self.entries(boxes)
+	if err != nil {
+		return err
+	}
+
+	self.points.Remove(entries...)
+	return nil
+}
+
+func (self *Tree) Len() int {
+	return self.points.Len()
+}
+
+func (self *Tree) Clear() {
+	self.points.Clear()
+}
+
+/*
+Returns every box in the tree, ordered by their bounds.
+*/
+func (self *Tree) All() []Box {
+	boxes := make([]Box, 0, self.Len())
+	for _, e := range self.points.All() {
+		boxes = append(boxes, e.(*entry).box)
+	}
+
+	return boxes
+}
+
+/*
+the bounds on the points for a query, each query dimension giving the
+bounds on the lows and the highs of the boxes.  Returns false if the
+query is empty in some dimension and so matches nothing.
+*/
+func (self *Tree) translate(query r.Query, fn func(low, high int) (lows, highs r.Bounds)) (r.Query, bool) {
+	bounds := make([]r.Bounds, 0, 2*self.maxDimensions)
+	for dimension := 1; dimension <= self.maxDimensions; dimension++ {
+		low, high := r.Inclusive(query.GetDimensionalBounds(dimension))
+		if low > high {
+			return nil, false
+		}
+
+		lows, highs := fn(low, high)
+		bounds = append(bounds, lows, highs)
+	}
+
+	return r.NewQuery(bounds...), true
+}
+
+func (self *Tree) collect(query r.Query) []Box {
+	boxes := make([]Box, 0)
+	self.points.Range(query, func(e r.Entry) bool {
+		boxes = append(boxes, e.(*entry).box)
+		return true
+	})
+
+	return boxes
+}
+
+/*
+Returns the boxes that share at least one point with the query.
+*/
+func (self *Tree) Intersecting(query r.Query) []Box {
+	q, ok := self.translate(query, func(low, high int) (r.Bounds, r.Bounds) {
+		return r.AtMost(high), r.AtLeast(low)
+	})
+	if !ok {
+		return nil
+	}
+
+	return self.collect(q)
+}
+
+/*
+Returns the boxes lying entirely within the query.
+*/
+func (self *Tree) Within(query r.Query) []Box {
+	q, ok := self.translate(query, func(low, high int) (r.Bounds, r.Bounds) {
+		return r.AtLeast(low), r.AtMost(high)
+	})
+	if !ok {
+		return nil
+	}
+
+	return self.collect(q)
+}
+
+/*
+Returns the boxes containing the point, given as one value per dimension
+starting with dimension 1.  Returns nil if the number of values doesn't
+match the tree.
+*/
+func (self *Tree) Containing(point ...int) []Box {
+	if len(point) != self.maxDimensions {
+		return nil
+	}
+
+	bounds := make([]r.Bounds, len(point))
+	for i, value := range point {
+		bounds[i] = r.Closed(value, value)
+	}
+
+	return self.Intersecting(r.NewQuery(bounds...))
+}
+
+/*
+Builds a tree over the boxes, panics if any of them is invalid.
+*/
+func New(maxDimensions int, boxes ...Box) *Tree {
+	tree, err := NewChecked(maxDimensions, boxes...)
+	if err != nil {
+		panic(err)
+	}
+
+	return tree
+}
+
+/*
+Builds a tree like New, returning an error instead of panicking when a box
+is invalid.
+*/
+func NewChecked(maxDimensions int, boxes ...Box) (*Tree, error) {
+	tree := &Tree{maxDimensions: maxDimensions}
+	entries, err := tree.entries(boxes)
+	if err != nil {
+		return nil, err
+	}
+
+	tree.points = v1.NewWithOptions(2*maxDimensions, v1.Options{Duplicates: r.Multiset}, entries...)
+	return tree, nil
+}
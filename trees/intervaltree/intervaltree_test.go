@@ -0,0 +1,164 @@
+package intervaltree
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+type rect struct {
+	low, high [2]int
+}
+
+func (self *rect) GetDimensionalBounds(dimension int) r.Bounds {
+	return r.Closed(self.low[dimension-1], self.high[dimension-1])
+}
+
+func (self *rect) MaxDimensions() int {
+	return 2
+}
+
+/*
+a box backed by a slice, which can't be compared with ==
+*/
+type span []int
+
+func (self span) GetDimensionalBounds(dimension int) r.Bounds {
+	return r.Closed(self[2*dimension-2], self[2*dimension-1])
+}
+
+func (self span) MaxDimensions() int {
+	return len(self) / 2
+}
+
+func newRect(x1, y1, x2, y2 int) *rect {
+	return &rect{[2]int{x1, y1}, [2]int{x2, y2}}
+}
+
+func randomRect(rnd *rand.Rand, max int) *rect {
+	x, y := rnd.Intn(max), rnd.Intn(max)
+	return newRect(x, y, x+rnd.Intn(max/4), y+rnd.Intn(max/4))
+}
+
+func checkBoxes(t *testing.T, name string, received []Box, expected map[Box]bool) {
+	if len(received) != len(expected) {
+		t.Errorf(`%s: expected len: %d, received: %d`, name, len(expected), len(received))
+	}
+
+	for _, box := range received {
+		if !expected[box] {
+			t.Errorf(`%s: unexpected box: %+v`, name, box)
+		}
+	}
+}
+
+func TestQueriesMatchBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(19))
+	rects := make([]*rect, 0, 300)
+	boxes := make([]Box, 0, 300)
+	for i := 0; i < 300; i++ {
+		rects = append(rects, randomRect(rnd, 100))
+		boxes = append(boxes, rects[i])
+	}
+	tree := New(2, boxes...)
+
+	for i := 0; i < 100; i++ {
+		query := randomRect(rnd, 100)
+
+		intersecting, within, containing := map[Box]bool{}, map[Box]bool{}, map[Box]bool{}
+		for _, box := range rects {
+			overlaps, inside, holds := true, true, true
+			for d := 0; d < 2; d++ {
+				overlaps = overlaps && box.low[d] <= query.high[d] && box.high[d] >= query.low[d]
+				inside = inside && box.low[d] >= query.low[d] && box.high[d] <= query.high[d]
+				holds = holds && box.low[d] <= query.low[d] && box.high[d] >= query.low[d]
+			}
+
+			if overlaps {
+				intersecting[box] = true
+			}
+			if inside {
+				within[box] = true
+			}
+			if holds {
+				containing[box] = true
+			}
+		}
+
+		checkBoxes(t, `intersecting`, tree.Intersecting(query), intersecting)
+		checkBoxes(t, `within`, tree.Within(query), within)
+		checkBoxes(t, `containing`, tree.Containing(query.low[0], query.low[1]), containing)
+	}
+}
+
+func TestRemoveKeepsBoxesWithSameBounds(t *testing.T) {
+	a, b, c := newRect(0, 0, 4, 4), newRect(0, 0, 4, 4), newRect(2, 2, 9, 9)
+	tree := New(2, a, b, c)
+
+	tree.Remove(a)
+	checkBoxes(t, `after remove`, tree.Containing(1, 1), map[Box]bool{b: true})
+
+	tree.Remove(newRect(2, 2, 9, 9))
+	if tree.Len() != 2 {
+		t.Errorf(`Expected an equal but distinct box to stay, len: %d`, tree.Len())
+	}
+
+	tree.Insert(a)
+	tree.Remove(b, c)
+	checkBoxes(t, `all`, tree.All(), map[Box]bool{a: true})
+}
+
+func TestRemoveUncomparableBox(t *testing.T) {
+	a := newRect(0, 0, 4, 4)
+	tree := New(2, span{0, 4, 0, 4}, span{2, 9, 2, 9}, a)
+
+	tree.Remove(span{0, 4, 0, 4})
+	if tree.Len() != 2 {
+		t.Fatalf(`Expected len: %d, received: %d`, 2, tree.Len())
+	}
+
+	// a box of another type with the same bounds is left alone
+	boxes := tree.Containing(1, 1)
+	if len(boxes) != 1 || boxes[0] != Box(a) {
+		t.Errorf(`Expected only the rect to stay, received: %+v`, boxes)
+	}
+}
+
+func TestUnboundedQueries(t *testing.T) {
+	row, column := newRect(3, 0, 3, 50), newRect(0, 7, 80, 7)
+	tree := New(2, row, column)
+
+	checkBoxes(t, `whole row`, tree.Intersecting(r.NewQuery(r.Closed(3, 3))), map[Box]bool{row: true, column: true})
+	checkBoxes(t, `within`, tree.Within(r.NewQuery(nil, r.AtMost(50))), map[Box]bool{row: true, column: true})
+	checkBoxes(t, `crossing`, tree.Containing(3, 7), map[Box]bool{row: true, column: true})
+
+	if boxes := tree.Intersecting(r.NewQuery(r.Open(3, 4))); boxes != nil {
+		t.Errorf(`Expected an empty query to match nothing, received: %+v`, boxes)
+	}
+
+	if boxes := tree.Containing(3); boxes != nil {
+		t.Errorf(`Expected a point of the wrong size to match nothing, received: %+v`, boxes)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tree := New(2)
+
+	if err := tree.InsertChecked(nil); !errors.Is(err, ErrNilBox) {
+		t.Errorf(`Expected nil box, received: %v`, err)
+	}
+
+	if err := tree.InsertChecked(newRect(5, 0, 4, 0)); !errors.Is(err, ErrEmptyBox) {
+		t.Errorf(`Expected empty box, received: %v`, err)
+	}
+
+	if _, err := NewChecked(3, newRect(0, 0, 1, 1)); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	if tree.Len() != 0 {
+		t.Errorf(`Expected nothing inserted, len: %d`, tree.Len())
+	}
+}
@@ -0,0 +1,791 @@
+/*
+Package kdtree is a range tree for many dimensions in O(n) space.  It
+implements rangetree.RangeTree over the same Entry, Query and Bounds as
+the layered trees, which need O(n log^(d-1) n) space and so grow too large
+past three or four dimensions.
+
+Each node holds the entries at one set of coordinates and splits the
+space below it on one dimension, cycling through the dimensions with
+depth: entries with a lower value go left, the rest go right.  Every node
+also keeps the number of entries below it and their bounding box, so a
+query skips subtrees outside it and counts subtrees inside it without
+visiting them.  A range query visits O(n^(1-1/d) + k) nodes rather than
+the O(log^d n + k) of the layered trees, in the order of Compare by way
+of a heap of the subtrees it has yet to enter, which adds a logarithmic
+factor to each.
+
+Subtrees that grow lopsided from inserts and removes are rebuilt around
+the median, keeping the depth logarithmic.  When a dimension holds too
+few distinct values to split evenly the rebuilt subtree stays lopsided,
+and it isn't rebuilt again until it has doubled or halved.
+*/
+package kdtree
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+A subtree is rebuilt once one child holds more than this share of its
+entries, and it has more than minRebuild entries.
+*/
+const (
+	alpha      = 0.75
+	minRebuild = 8
+)
+
+/*
+Options tune the behavior of a tree.  The zero value is the default.
+*/
+type Options struct {
+	/*
+		What to do with entries sharing every coordinate, Replace by
+		default.
+	*/
+	Duplicates r.DuplicateMode
+}
+
+type node struct {
+	left      *node
+	right     *node
+	entries   []r.Entry // share coordinates, more than one only in a multiset
+	dimension int       // the dimension this node splits on
+	size      int       // entries at and below this node
+	lopsided  int       // the size when built, if the values allowed no even split
+	low       []int     // the bounding box of every entry below
+	high      []int
+}
+
+func newNode(entries []r.Entry, dimension, maxDimensions int) *node {
+	n := &node{
+		entries:   entries,
+		dimension: dimension,
+		low:       make([]int, maxDimensions),
+		high:      make([]int, maxDimensions),
+	}
+	n.refresh()
+
+	return n
+}
+
+func (self *node) key() r.Entry {
+	return self.entries[0]
+}
+
+func (self *node) value() int {
+	return self.key().GetDimensionalValue(self.dimension)
+}
+
+/*
+recomputes the size and bounding box from the entries and the children
+*/
+func (self *node) refresh() {
+	self.size = len(self.entries)
+	for i := range self.low {
+		value := self.key().GetDimensionalValue(i + 1)
+		self.low[i], self.high[i] = value, value
+	}
+
+	self.extend(self.left)
+	self.extend(self.right)
+}
+
+func (self *node) extend(child *node) {
+	if child == nil {
+		return
+	}
+
+	self.size += child.size
+	for i := range self.low {
+		self.low[i] = min(self.low[i], child.low[i])
+		self.high[i] = max(self.high[i], child.high[i])
+	}
+}
+
+func sizeOf(n *node) int {
+	if n == nil {
+		return 0
+	}
+
+	return n.size
+}
+
+func (self *node) unbalanced() bool {
+	if self.size <= minRebuild || float64(max(sizeOf(self.left), sizeOf(self.right))) <= alpha*float64(self.size) {
+		return false
+	}
+
+	// a rebuild would split the same values the same way until the subtree
+	// has doubled or halved
+	return self.lopsided == 0 || self.size >= 2*self.lopsided || 2*self.size <= self.lopsided
+}
+
+/*
+appends the entries of every node below this one, one group per node
+*/
+func (self *node) groups(groups [][]r.Entry) [][]r.Entry {
+	if self == nil {
+		return groups
+	}
+
+	groups = self.left.groups(groups)
+	groups = append(groups, self.entries)
+	return self.right.groups(groups)
+}
+
+/*
+builds a balanced subtree splitting on dimension at its root.  Each group
+holds the entries at one set of coordinates, groups is reordered.
+*/
+func build(groups [][]r.Entry, dimension, maxDimensions int) *node {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(groups, func(a, b []r.Entry) int {
+		return cmp.Compare(a[0].GetDimensionalValue(dimension), b[0].GetDimensionalValue(dimension))
+	})
+
+	// everything left of the split must be strictly lower, so the split
+	// goes before or after the values equal to the median's, whichever is
+	// nearer the middle
+	middle := len(groups) / 2
+	value := groups[middle][0].GetDimensionalValue(dimension)
+	below, above := middle, middle
+	for below > 0 && groups[below-1][0].GetDimensionalValue(dimension) == value {
+		below--
+	}
+	for above < len(groups) && groups[above][0].GetDimensionalValue(dimension) == value {
+		above++
+	}
+
+	median := below
+	if above < len(groups) && above-middle < middle-below {
+		median = above
+	}
+
+	next := dimension%maxDimensions + 1
+	n := newNode(groups[median], dimension, maxDimensions)
+	n.left = build(groups[:median], next, maxDimensions)
+	n.right = build(groups[median+1:], next, maxDimensions)
+	n.refresh()
+
+	if n.unbalanced() {
+		n.lopsided = n.size
+	}
+
+	return n
+}
+
+func (self *node) rebuild(maxDimensions int) *node {
+	return build(self.groups(nil), self.dimension, maxDimensions)
+}
+
+func (self *node) balance(maxDimensions int) *node {
+	if self.unbalanced() {
+		return self.rebuild(maxDimensions)
+	}
+
+	return self
+}
+
+/*
+returns the node with the lowest value in dimension below this one
+*/
+func (self *node) min(dimension int) *node {
+	if self.dimension == dimension {
+		if self.left == nil {
+			return self
+		}
+		return self.left.min(dimension)
+	}
+
+	result := self
+	for _, child := range [...]*node{self.left, self.right} {
+		// the bounding box rules out children that can't do better
+		if child == nil || child.low[dimension-1] >= result.key().GetDimensionalValue(dimension) {
+			continue
+		}
+
+		if n := child.min(dimension); n.key().GetDimensionalValue(dimension) < result.key().GetDimensionalValue(dimension) {
+			result = n
+		}
+	}
+
+	return result
+}
+
+/*
+returns the node at the coordinates of entry, nil if there isn't one
+*/
+func (self *node) find(point valuer) *node {
+	n := self
+	for n != nil {
+		value := point.GetDimensionalValue(n.dimension)
+		switch {
+		case value < n.value():
+			n = n.left
+		case sameCoordinates(n.key(), point, len(n.low)):
+			return n
+		default:
+			n = n.right
+		}
+	}
+
+	return nil
+}
+
+/*
+anything that can give its value in a dimension, an entry or a set of
+coordinates
+*/
+type valuer interface {
+	GetDimensionalValue(dimension int) int
+}
+
+func sameCoordinates(a, b valuer, maxDimensions int) bool {
+	for dimension := 1; dimension <= maxDimensions; dimension++ {
+		if a.GetDimensionalValue(dimension) != b.GetDimensionalValue(dimension) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+the inclusive bounds of a query in each dimension
+*/
+type box struct {
+	low, high []int
+}
+
+/*
+returns the box for the query, false if it is empty in some dimension
+*/
+func newBox(query r.Query, maxDimensions int) (box, bool) {
+	b := box{make([]int, maxDimensions), make([]int, maxDimensions)}
+	for i := range b.low {
+		b.low[i], b.high[i] = r.Inclusive(query.GetDimensionalBounds(i + 1))
+		if b.low[i] > b.high[i] {
+			return b, false
+		}
+	}
+
+	return b, true
+}
+
+func (self box) holds(entry r.Entry) bool {
+	for i := range self.low {
+		value := entry.GetDimensionalValue(i + 1)
+		if value < self.low[i] || value > self.high[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (self box) misses(n *node) bool {
+	for i := range self.low {
+		if n.high[i] < self.low[i] || n.low[i] > self.high[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self box) covers(n *node) bool {
+	for i := range self.low {
+		if n.low[i] < self.low[i] || n.high[i] > self.high[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+a subtree Range has reached but not entered, or only the entries of a
+node whose children it has
+*/
+type pending struct {
+	node    *node
+	entries bool
+}
+
+/*
+the lowest value in dimension anything pending could have within the box
+*/
+func (self pending) low(b box, dimension int) int {
+	if self.entries {
+		return self.node.key().GetDimensionalValue(dimension)
+	}
+
+	return max(self.node.low[dimension-1], b.low[dimension-1])
+}
+
+/*
+a binary heap of pending subtrees and entries, lowest first in the order
+of Compare.  Every entry below a subtree comes at or after the lowest
+corner of its bounding box within the query, so entries leave the heap in
+the order of Compare.
+*/
+type frontier struct {
+	b     box
+	items []pending
+}
+
+func (self *frontier) less(i, j int) bool {
+	a, b := self.items[i], self.items[j]
+	for dimension := 1; dimension <= len(self.b.low); dimension++ {
+		if x, y := a.low(self.b, dimension), b.low(self.b, dimension); x != y {
+			return x < y
+		}
+	}
+
+	// no subtree holds the coordinates of a node outside it
+	return a.entries && !b.entries
+}
+
+func (self *frontier) push(p pending) {
+	self.items = append(self.items, p)
+	for i := len(self.items) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !self.less(i, parent) {
+			break
+		}
+
+		self.items[i], self.items[parent] = self.items[parent], self.items[i]
+		i = parent
+	}
+}
+
+func (self *frontier) pop() pending {
+	top, last := self.items[0], len(self.items)-1
+	self.items[0] = self.items[last]
+	self.items = self.items[:last]
+
+	for i := 0; ; {
+		lowest := i
+		for _, child := range [...]int{2*i + 1, 2*i + 2} {
+			if child < last && self.less(child, lowest) {
+				lowest = child
+			}
+		}
+
+		if lowest == i {
+			return top
+		}
+
+		self.items[i], self.items[lowest] = self.items[lowest], self.items[i]
+		i = lowest
+	}
+}
+
+func (self *node) count(b box) int {
+	if self == nil || b.misses(self) {
+		return 0
+	}
+
+	if b.covers(self) {
+		return self.size
+	}
+
+	count := self.left.count(b) + self.right.count(b)
+	if b.holds(self.key()) {
+		count += len(self.entries)
+	}
+
+	return count
+}
+
+func (self *node) copy() *node {
+	if self == nil {
+		return nil
+	}
+
+	return &node{
+		left:      self.left.copy(),
+		right:     self.right.copy(),
+		entries:   slices.Clone(self.entries),
+		dimension: self.dimension,
+		size:      self.size,
+		lopsided:  self.lopsided,
+		low:       slices.Clone(self.low),
+		high:      slices.Clone(self.high),
+	}
+}
+
+/*
+Tree is a kd-tree over entries of a fixed number of dimensions.
+*/
+type Tree struct {
+	root          *node
+	maxDimensions int
+	options       Options
+}
+
+/*
+returns the node that takes the place of n once entry is inserted below
+it and the number of entries added
+*/
+func (self *Tree) insert(n *node, entry r.Entry, dimension int) (*node, int) {
+	if n == nil {
+		return newNode([]r.Entry{entry}, dimension, self.maxDimensions), 1
+	}
+
+	added := 0
+	next := n.dimension%self.maxDimensions + 1
+	switch {
+	case entry.GetDimensionalValue(n.dimension) < n.value():
+		n.left, added = self.insert(n.left, entry, next)
+	case !sameCoordinates(n.key(), entry, self.maxDimensions):
+		n.right, added = self.insert(n.right, entry, next)
+	case self.options.Duplicates == r.Replace:
+		n.entries[0] = entry
+		return n, 0
+	case self.options.Duplicates == r.Set:
+		return n, 0
+	default:
+		n.entries = append(n.entries, entry)
+		added = 1
+	}
+
+	n.refresh()
+	return n.balance(self.maxDimensions), added
+}
+
+/*
+returns the node that takes the place of n once entry is removed below it
+and the number of entries removed.  whole removes everything at the
+coordinates of entry, otherwise only the entry itself is given up.
+*/
+func (self *Tree) remove(n *node, entry r.Entry, whole bool) (*node, int) {
+	if n == nil {
+		return nil, 0
+	}
+
+	removed := 0
+	switch {
+	case entry.GetDimensionalValue(n.dimension) < n.value():
+		n.left, removed = self.remove(n.left, entry, whole)
+	case !sameCoordinates(n.key(), entry, self.maxDimensions):
+		n.right, removed = self.remove(n.right, entry, whole)
+	case whole:
+		removed = len(n.entries)
+		n.entries = nil
+	default:
+		i := slices.IndexFunc(n.entries, func(e r.Entry) bool {
+			return r.SameEntry(e, entry)
+		})
+		if i < 0 {
+			return n, 0
+		}
+
+		n.entries = slices.Delete(slices.Clone(n.entries), i, i+1)
+		removed = 1
+	}
+
+	if removed == 0 {
+		return n, 0
+	}
+
+	if len(n.entries) == 0 {
+		return self.delete(n), removed
+	}
+
+	n.refresh()
+	return n.balance(self.maxDimensions), removed
+}
+
+/*
+returns the node that takes the place of n, whose entries are gone, by
+moving up the lowest node in its split dimension from a child
+*/
+func (self *Tree) delete(n *node) *node {
+	switch {
+	case n.right != nil:
+		m := n.right.min(n.dimension)
+		n.entries = m.entries
+		n.right, _ = self.remove(n.right, m.key(), true)
+	case n.left != nil:
+		// everything left is now at or above the new key, so it goes right
+		m := n.left.min(n.dimension)
+		n.entries = m.entries
+		n.right, _ = self.remove(n.left, m.key(), true)
+		n.left = nil
+	default:
+		return nil
+	}
+
+	n.refresh()
+	return n.balance(self.maxDimensions)
+}
+
+/*
+returns the node that takes the place of n once the entries within the
+box are removed and the number removed.  Subtrees within the box are cut
+out whole.
+*/
+func (self *Tree) removeRange(n *node, b box) (*node, int) {
+	if n == nil || b.misses(n) {
+		return n, 0
+	}
+
+	if b.covers(n) {
+		return nil, n.size
+	}
+
+	var left, right int
+	n.left, left = self.removeRange(n.left, b)
+	n.right, right = self.removeRange(n.right, b)
+	removed := left + right
+
+	if b.holds(n.key()) {
+		removed += len(n.entries)
+		n.entries = nil
+		return self.delete(n), removed
+	}
+
+	if removed == 0 {
+		return n, 0
+	}
+
+	n.refresh()
+	return n.balance(self.maxDimensions), removed
+}
+
+func (self *Tree) Insert(entries ...r.Entry) {
+	if err := self.InsertChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *Tree) InsertChecked(entries ...r.Entry) error {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		self.root, _ = self.insert(self.root, entry, 1)
+	}
+
+	return nil
+}
+
+func (self *Tree) Remove(entries ...r.Entry) {
+	if err := self.RemoveChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *Tree) RemoveChecked(entries ...r.Entry) error {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		self.root, _ = self.remove(self.root, entry, false)
+	}
+
+	return nil
+}
+
+func (self *Tree) Update(old, entry r.Entry) bool {
+	if err := r.ValidateEntries(self.maxDimensions, old, entry); err != nil {
+		panic(err)
+	}
+
+	var removed int
+	self.root, removed = self.remove(self.root, old, false)
+	if removed == 0 {
+		return false
+	}
+
+	self.root, _ = self.insert(self.root, entry, 1)
+	return true
+}
+
+func (self *Tree) RemoveRange(query r.Query) int {
+	b, ok := newBox(query, self.maxDimensions)
+	if !ok {
+		return 0
+	}
+
+	var removed int
+	self.root, removed = self.removeRange(self.root, b)
+	return removed
+}
+
+func (self *Tree) GetRange(query r.Query) []r.Entry {
+	entries := make([]r.Entry, 0)
+	self.Range(query, func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+/*
+A kd-tree doesn't hold its entries in the order of Compare, so Range
+enters the subtrees within the query lowest corner first, keeping those
+it has reached in a heap, and each entry is visited once nothing left in
+the heap could come before it.  Only the heap is allocated, it holds the
+subtrees the walk has reached but not entered, which for a balanced tree
+is about the number a plane through the query crosses, O(n^(1-1/d)), not
+the entries visited.
+*/
+func (self *Tree) Range(query r.Query, fn func(r.Entry) bool) {
+	b, ok := newBox(query, self.maxDimensions)
+	if !ok || self.root == nil || b.misses(self.root) {
+		return
+	}
+
+	f := &frontier{b: b}
+	f.push(pending{node: self.root})
+	for len(f.items) > 0 {
+		p := f.pop()
+		if p.entries {
+			for _, entry := range p.node.entries {
+				if !fn(entry) {
+					return
+				}
+			}
+			continue
+		}
+
+		if b.holds(p.node.key()) {
+			f.push(pending{node: p.node, entries: true})
+		}
+
+		for _, child := range [...]*node{p.node.left, p.node.right} {
+			if child != nil && !b.misses(child) {
+				f.push(pending{node: child})
+			}
+		}
+	}
+}
+
+func (self *Tree) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.Range(query, yield)
+	}
+}
+
+func (self *Tree) Count(query r.Query) int {
+	b, ok := newBox(query, self.maxDimensions)
+	if !ok || self.root == nil {
+		return 0
+	}
+
+	return self.root.count(b)
+}
+
+func (self *Tree) Get(values ...int) []r.Entry {
+	if len(values) != self.maxDimensions || self.root == nil {
+		return nil
+	}
+
+	n := self.root.find(r.Coordinates(values))
+	if n == nil {
+		return nil
+	}
+
+	return slices.Clone(n.entries)
+}
+
+func (self *Tree) Contains(entry r.Entry) bool {
+	if r.ValidateEntries(self.maxDimensions, entry) != nil || self.root == nil {
+		return false
+	}
+
+	n := self.root.find(entry)
+	if n == nil {
+		return false
+	}
+
+	return slices.ContainsFunc(n.entries, func(e r.Entry) bool {
+		return r.SameEntry(e, entry)
+	})
+}
+
+func (self *Tree) Copy() r.RangeTree {
+	return &Tree{
+		root:          self.root.copy(),
+		maxDimensions: self.maxDimensions,
+		options:       self.options,
+	}
+}
+
+func (self *Tree) Clear() {
+	self.root = nil
+}
+
+func (self *Tree) Len() int {
+	return sizeOf(self.root)
+}
+
+/*
+Returns every entry in the order of Compare.
+*/
+func (self *Tree) All() []r.Entry {
+	return self.GetRange(r.NewQuery())
+}
+
+func New(maxDimensions int, entries ...r.Entry) *Tree {
+	return NewWithOptions(maxDimensions, Options{}, entries...)
+}
+
+func NewWithOptions(maxDimensions int, options Options, entries ...r.Entry) *Tree {
+	t, err := NewChecked(maxDimensions, options, entries...)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+/*
+Builds a balanced tree over the entries in O(n log^2 n), returning an
+error instead of panicking when an entry is invalid.  The entries are not
+modified.
+*/
+func NewChecked(maxDimensions int, options Options, entries ...r.Entry) (*Tree, error) {
+	if err := r.ValidateEntries(maxDimensions, entries...); err != nil {
+		return nil, err
+	}
+
+	t := &Tree{maxDimensions: maxDimensions, options: options}
+
+	// group the entries sharing coordinates as inserting them would
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, func(a, b r.Entry) int {
+		return r.Compare(a, b, maxDimensions)
+	})
+
+	groups := make([][]r.Entry, 0, len(sorted))
+	for i, entry := range sorted {
+		if i == 0 || !sameCoordinates(sorted[i-1], entry, maxDimensions) {
+			groups = append(groups, []r.Entry{entry})
+			continue
+		}
+
+		last := groups[len(groups)-1]
+		switch options.Duplicates {
+		case r.Replace:
+			last[0] = entry
+		case r.Multiset:
+			groups[len(groups)-1] = append(last, entry)
+		}
+	}
+
+	t.root = build(groups, 1, maxDimensions)
+	return t, nil
+}
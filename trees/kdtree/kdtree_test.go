@@ -0,0 +1,327 @@
+package kdtree
+
+import (
+	"errors"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/rangetreetest"
+	"github.com/dzyp/data/trees/rangetree/v1"
+)
+
+type event struct {
+	coordinates [4]int
+	id          int
+}
+
+func (self *event) GetDimensionalValue(dimension int) int {
+	return self.coordinates[dimension-1]
+}
+
+func (self *event) MaxDimensions() int {
+	return len(self.coordinates)
+}
+
+func (self *event) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+var ids int
+
+func randomEvent(rnd *rand.Rand, max int) *event {
+	ids++
+	return &event{[4]int{rnd.Intn(max), rnd.Intn(max), rnd.Intn(max), rnd.Intn(max)}, ids}
+}
+
+func randomQuery(rnd *rand.Rand, max int) r.Query {
+	bounds := make([]r.Bounds, 4)
+	for i := range bounds {
+		if rnd.Intn(4) == 0 {
+			continue // unbounded
+		}
+
+		low := rnd.Intn(max)
+		bounds[i] = r.Closed(low, low+rnd.Intn(max/2))
+	}
+
+	return r.NewQuery(bounds...)
+}
+
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+
+	return 1 + max(height(n.left), height(n.right))
+}
+
+/*
+checks sizes and bounding boxes against the entries below every node,
+along with the split invariant
+*/
+func checkNode(t *testing.T, n *node) (int, []int, []int) {
+	if n == nil {
+		return 0, nil, nil
+	}
+
+	size, low, high := len(n.entries), make([]int, len(n.low)), make([]int, len(n.high))
+	for i := range low {
+		low[i] = n.key().GetDimensionalValue(i + 1)
+		high[i] = low[i]
+	}
+
+	for _, child := range []*node{n.left, n.right} {
+		childSize, childLow, childHigh := checkNode(t, child)
+		size += childSize
+		for i := range childLow {
+			low[i], high[i] = min(low[i], childLow[i]), max(high[i], childHigh[i])
+		}
+	}
+
+	if n.left != nil && n.left.high[n.dimension-1] >= n.value() {
+		t.Errorf(`Expected the left of a node to be below its value.`)
+	}
+
+	if n.right != nil && n.right.low[n.dimension-1] < n.value() {
+		t.Errorf(`Expected the right of a node to be at or above its value.`)
+	}
+
+	if size != n.size {
+		t.Errorf(`Expected size: %d, received: %d`, size, n.size)
+	}
+
+	for i := range low {
+		if low[i] != n.low[i] || high[i] != n.high[i] {
+			t.Errorf(`Expected box: %v %v, received: %v %v`, low, high, n.low, n.high)
+			break
+		}
+	}
+
+	return size, low, high
+}
+
+func checkSame(t *testing.T, expected, received []r.Entry) {
+	if len(expected) != len(received) {
+		t.Fatalf(`Expected len: %d, received: %d`, len(expected), len(received))
+	}
+
+	for i := range expected {
+		if expected[i] != received[i] {
+			t.Fatalf(`Expected: %+v at %d, received: %+v`, expected[i], i, received[i])
+		}
+	}
+}
+
+func TestMatchesLayeredTree(t *testing.T) {
+	for _, mode := range []r.DuplicateMode{r.Replace, r.Set, r.Multiset} {
+		rnd := rand.New(rand.NewSource(int64(mode) + 41))
+		max := 8
+
+		initial := make([]r.Entry, 0, 200)
+		for i := 0; i < 200; i++ {
+			initial = append(initial, randomEvent(rnd, max))
+		}
+
+		kd := NewWithOptions(4, Options{Duplicates: mode}, initial...)
+		layered := v1.NewWithOptions(4, v1.Options{Duplicates: mode}, initial...)
+
+		for i := 0; i < 600; i++ {
+			switch rnd.Intn(5) {
+			case 0, 1:
+				entry := randomEvent(rnd, max)
+				kd.Insert(entry)
+				layered.Insert(entry)
+			case 2:
+				all := layered.All()
+				if len(all) > 0 {
+					entry := all[rnd.Intn(len(all))]
+					kd.Remove(entry)
+					layered.Remove(entry)
+				}
+			case 3:
+				all := layered.All()
+				if len(all) > 0 {
+					old, entry := all[rnd.Intn(len(all))], randomEvent(rnd, max)
+					if kd.Update(old, entry) != layered.Update(old, entry) {
+						t.Fatalf(`%s: expected Update to agree.`, mode)
+					}
+				}
+			case 4:
+				if i%20 == 0 {
+					query := randomQuery(rnd, max)
+					if kd.RemoveRange(query) != layered.RemoveRange(query) {
+						t.Fatalf(`%s: expected RemoveRange to agree.`, mode)
+					}
+				}
+			}
+
+			query := randomQuery(rnd, max)
+			checkSame(t, layered.GetRange(query), kd.GetRange(query))
+			if kd.Count(query) != layered.Count(query) {
+				t.Fatalf(`%s: expected count: %d, received: %d`, mode, layered.Count(query), kd.Count(query))
+			}
+
+			if kd.Len() != layered.Len() {
+				t.Fatalf(`%s: expected len: %d, received: %d`, mode, layered.Len(), kd.Len())
+			}
+		}
+
+		checkSame(t, layered.All(), kd.All())
+		checkNode(t, kd.root)
+	}
+}
+
+func TestStaysBalanced(t *testing.T) {
+	tree := New(4)
+	events := make([]*event, 4096)
+	for i := range events {
+		events[i] = &event{[4]int{i, i, i, i}, i}
+		tree.Insert(events[i])
+	}
+
+	if h := height(tree.root); h > 3*12 {
+		t.Errorf(`Expected a logarithmic height after sorted inserts, received: %d`, h)
+	}
+
+	for i := 0; i < 4000; i++ {
+		tree.Remove(events[i])
+	}
+
+	if tree.Len() != 96 || height(tree.root) > 3*7 {
+		t.Errorf(`Expected len: %d, received: %d, height: %d`, 96, tree.Len(), height(tree.root))
+	}
+	checkNode(t, tree.root)
+}
+
+func TestLowCardinalityDimension(t *testing.T) {
+	for _, values := range []int{1, 2, 5} {
+		rnd := rand.New(rand.NewSource(int64(values)))
+		tree := New(4)
+		events := make([]*event, 4000)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for i := range events {
+			events[i] = &event{[4]int{rnd.Intn(values), rnd.Intn(1 << 20), rnd.Intn(1 << 20), rnd.Intn(1 << 20)}, i}
+			tree.Insert(events[i])
+		}
+		for _, e := range events[:3000] {
+			tree.Remove(e)
+		}
+		runtime.ReadMemStats(&after)
+
+		// rebuilding a subtree on every write would allocate millions of times
+		if mallocs := after.Mallocs - before.Mallocs; mallocs > 40*uint64(len(events)) {
+			t.Errorf(`%d values: expected few rebuilds, received: %d allocations`, values, mallocs)
+		}
+
+		if tree.Len() != 1000 || height(tree.root) > 3*12 {
+			t.Errorf(`%d values: expected len: %d, received: %d, height: %d`, values, 1000, tree.Len(), height(tree.root))
+		}
+		checkNode(t, tree.root)
+	}
+}
+
+func TestGetContainsAndCopy(t *testing.T) {
+	a, b := &event{[4]int{1, 2, 3, 4}, 1}, &event{[4]int{1, 2, 3, 4}, 2}
+	tree := NewWithOptions(4, Options{Duplicates: r.Multiset}, a, b)
+
+	if entries := tree.Get(1, 2, 3, 4); len(entries) != 2 || entries[0] != a {
+		t.Errorf(`Expected both entries in order, received: %+v`, entries)
+	}
+
+	if tree.Get(1, 2, 3) != nil || tree.Get(4, 3, 2, 1) != nil {
+		t.Errorf(`Expected nothing at other coordinates.`)
+	}
+
+	cp := tree.Copy()
+	tree.Remove(a)
+	if tree.Contains(a) || !tree.Contains(b) || !cp.Contains(a) || cp.Len() != 2 {
+		t.Errorf(`Expected the copy to be left alone.`)
+	}
+
+	cp.Clear()
+	if cp.Len() != 0 || len(cp.All()) != 0 || tree.Len() != 1 {
+		t.Errorf(`Expected only the copy cleared.`)
+	}
+}
+
+func TestRangeStopsEarly(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	tree := New(4)
+	for i := 0; i < 100; i++ {
+		tree.Insert(randomEvent(rnd, 50))
+	}
+
+	visited := 0
+	for range tree.Iter(r.NewQuery()) {
+		visited++
+		if visited == 10 {
+			break
+		}
+	}
+
+	if visited != 10 {
+		t.Errorf(`Expected to stop after %d, received: %d`, 10, visited)
+	}
+
+	if entries := tree.GetRange(r.NewQuery(r.Open(3, 4))); len(entries) != 0 || tree.Count(r.NewQuery(r.Open(3, 4))) != 0 {
+		t.Errorf(`Expected an empty query to find nothing, received: %+v`, entries)
+	}
+}
+
+func TestRangeDoesNotGather(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	tree := New(4)
+	for i := 0; i < 1<<14; i++ {
+		tree.Insert(randomEvent(rnd, 1<<20))
+	}
+
+	// stopping early, then visiting everything in less than it would take
+	// to gather the entries, an interface of two words for each
+	for _, c := range []struct{ limit, bytes int }{{10, 1 << 13}, {tree.Len(), tree.Len() * 8}} {
+		var before, after runtime.MemStats
+		visited := 0
+		runtime.ReadMemStats(&before)
+		tree.Range(r.NewQuery(), func(r.Entry) bool {
+			visited++
+			return visited < c.limit
+		})
+		runtime.ReadMemStats(&after)
+
+		allocated := after.TotalAlloc - before.TotalAlloc
+		if visited != c.limit || allocated > uint64(c.bytes) {
+			t.Errorf(`Expected to visit %d in under %d bytes, received: %d, %d bytes`, c.limit, c.bytes, visited, allocated)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tree := New(4)
+
+	if err := tree.InsertChecked(nil); !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+
+	if _, err := NewChecked(3, Options{}, &event{}); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	if err := tree.RemoveChecked(&event{}, nil); !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	rangetreetest.RunConformance(t, func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+		return New(maxDimensions, entries...)
+	})
+}
+
+func TestConformanceWithModes(t *testing.T) {
+	rangetreetest.RunConformanceWithModes(t, func(maxDimensions int, mode r.DuplicateMode, entries ...r.Entry) r.RangeTree {
+		return NewWithOptions(maxDimensions, Options{Duplicates: mode}, entries...)
+	})
+}
@@ -0,0 +1,162 @@
+package rangetree
+
+import "math"
+
+/*
+InclusiveBounds may be implemented by bounds that are not half open, the
+trees use it in place of Low and High.  Every constructor in this package
+returns InclusiveBounds.
+*/
+type InclusiveBounds interface {
+	Bounds
+	/*
+		Returns the lowest and the highest value within the bounds, both
+		included.  The bounds are empty if low > high.
+	*/
+	Inclusive() (low, high int)
+}
+
+/*
+Returns the lowest and highest value within bounds, both included.  Nil
+bounds hold every value, plain Bounds are read as [Low, High).
+*/
+func Inclusive(bounds Bounds) (low, high int) {
+	switch b := bounds.(type) {
+	case nil:
+		return math.MinInt, math.MaxInt
+	case InclusiveBounds:
+		return b.Inclusive()
+	}
+
+	if bounds.High() == math.MinInt {
+		return math.MaxInt, math.MinInt
+	}
+
+	return bounds.Low(), bounds.High() - 1
+}
+
+/*
+bounds kept as an inclusive range, low > high when empty
+*/
+type interval struct {
+	low, high int
+}
+
+func (self interval) Inclusive() (int, int) {
+	return self.low, self.high
+}
+
+func (self interval) Low() int {
+	return self.low
+}
+
+/*
+High is exclusive, so it can't express math.MaxInt being included and
+saturates there.  The trees read Inclusive instead.
+*/
+func (self interval) High() int {
+	if self.high == math.MaxInt {
+		return math.MaxInt
+	}
+
+	return self.high + 1
+}
+
+/*
+Returns the bounds from low to high, each end included or not as flagged.
+*/
+func NewBounds(low int, lowIncluded bool, high int, highIncluded bool) InclusiveBounds {
+	if !lowIncluded {
+		if low == math.MaxInt {
+			return interval{math.MaxInt, math.MinInt}
+		}
+		low++
+	}
+
+	if !highIncluded {
+		if high == math.MinInt {
+			return interval{math.MaxInt, math.MinInt}
+		}
+		high--
+	}
+
+	return interval{low, high}
+}
+
+/*
+[low, high]
+*/
+func Closed(low, high int) InclusiveBounds {
+	return NewBounds(low, true, high, true)
+}
+
+/*
+(low, high)
+*/
+func Open(low, high int) InclusiveBounds {
+	return NewBounds(low, false, high, false)
+}
+
+/*
+[low, high), the same range a plain Bounds describes
+*/
+func HalfOpen(low, high int) InclusiveBounds {
+	return NewBounds(low, true, high, false)
+}
+
+/*
+Every value >= low.
+*/
+func AtLeast(low int) InclusiveBounds {
+	return interval{low, math.MaxInt}
+}
+
+/*
+Every value > low.
+*/
+func Above(low int) InclusiveBounds {
+	return NewBounds(low, false, math.MaxInt, true)
+}
+
+/*
+Every value <= high.
+*/
+func AtMost(high int) InclusiveBounds {
+	return interval{math.MinInt, high}
+}
+
+/*
+Every value < high.
+*/
+func Below(high int) InclusiveBounds {
+	return NewBounds(math.MinInt, true, high, false)
+}
+
+/*
+Every value, the same as nil bounds.
+*/
+func All() InclusiveBounds {
+	return interval{math.MinInt, math.MaxInt}
+}
+
+/*
+query holds the bounds for each dimension, starting with dimension 1
+*/
+type query []Bounds
+
+func (self query) GetDimensionalBounds(dimension int) Bounds {
+	if dimension > len(self) || self[dimension-1] == nil {
+		return All()
+	}
+
+	return self[dimension-1]
+}
+
+/*
+Returns a query with the given bounds for each dimension, starting with
+dimension 1.  Dimensions without bounds, or with nil bounds, hold every
+value.
+*/
+func NewQuery(bounds ...Bounds) Query {
+	return query(bounds)
+}
@@ -0,0 +1,73 @@
+package rangetree
+
+import (
+	"math"
+	"testing"
+)
+
+type halfOpen struct {
+	low, high int
+}
+
+func (self halfOpen) Low() int {
+	return self.low
+}
+
+func (self halfOpen) High() int {
+	return self.high
+}
+
+func TestInclusive(t *testing.T) {
+	tests := []struct {
+		bounds    Bounds
+		low, high int
+	}{
+		{nil, math.MinInt, math.MaxInt},
+		{halfOpen{1, 5}, 1, 4},
+		{halfOpen{1, math.MinInt}, math.MaxInt, math.MinInt},
+		{Closed(1, 5), 1, 5},
+		{Open(1, 5), 2, 4},
+		{HalfOpen(1, 5), 1, 4},
+		{AtLeast(5), 5, math.MaxInt},
+		{Above(5), 6, math.MaxInt},
+		{AtMost(5), math.MinInt, 5},
+		{Below(5), math.MinInt, 4},
+		{All(), math.MinInt, math.MaxInt},
+		{Closed(math.MaxInt, math.MaxInt), math.MaxInt, math.MaxInt},
+		{Above(math.MaxInt), math.MaxInt, math.MinInt},
+		{Below(math.MinInt), math.MaxInt, math.MinInt},
+		{NewBounds(1, false, 5, true), 2, 5},
+	}
+
+	for _, test := range tests {
+		low, high := Inclusive(test.bounds)
+		if low != test.low || high != test.high {
+			t.Errorf(`Expected: [%d, %d], received: [%d, %d] for %+v`,
+				test.low, test.high, low, high, test.bounds)
+		}
+	}
+}
+
+func TestHalfOpenView(t *testing.T) {
+	if b := Closed(1, 5); b.Low() != 1 || b.High() != 6 {
+		t.Errorf(`Expected [1, 6), received: [%d, %d)`, b.Low(), b.High())
+	}
+
+	if b := AtLeast(1); b.High() != math.MaxInt {
+		t.Errorf(`Expected high to saturate, received: %d`, b.High())
+	}
+}
+
+func TestNewQuery(t *testing.T) {
+	q := NewQuery(Closed(1, 2), nil)
+
+	if low, high := Inclusive(q.GetDimensionalBounds(1)); low != 1 || high != 2 {
+		t.Errorf(`Expected [1, 2], received: [%d, %d]`, low, high)
+	}
+
+	for _, dimension := range []int{2, 3} {
+		if low, high := Inclusive(q.GetDimensionalBounds(dimension)); low != math.MinInt || high != math.MaxInt {
+			t.Errorf(`Expected every value in dimension %d, received: [%d, %d]`, dimension, low, high)
+		}
+	}
+}
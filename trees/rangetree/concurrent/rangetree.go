@@ -0,0 +1,334 @@
+/*
+Package concurrent provides range trees that are safe for use by many
+goroutines at once.  Both wrap any rangetree.RangeTree.
+
+New guards the tree with a read/write mutex, any number of queries run in
+parallel while writes are exclusive.  Range and Iter take their matches a
+page at a time under the read lock and release it before calling back, so
+callbacks may use the tree freely.  Writes may land between pages, each
+page sees whatever version is current when it is read.
+
+NewCopyOnWrite never blocks readers.  Every write copies the current tree,
+applies the change to the copy and then publishes it atomically, so
+queries always see a complete version of the tree.  Writes cost a Copy of
+the wrapped tree and are serialized with each other.  Wrapping a tree from
+the persistent package makes that copy constant time.
+*/
+package concurrent
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+guarded protects a tree with a read/write mutex.  No lock is held while
+callbacks passed to Range, or loops over Iter, run.  Holding the read
+lock there would deadlock a callback that reads the tree once a writer is
+waiting, as a waiting writer blocks new readers.
+*/
+type guarded struct {
+	lock sync.RWMutex
+	tree r.RangeTree
+}
+
+func (self *guarded) Insert(entries ...r.Entry) {
+	entries = slices.Clone(entries) // trees may sort the caller's slice
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.tree.Insert(entries...)
+}
+
+func (self *guarded) Remove(entries ...r.Entry) {
+	entries = slices.Clone(entries)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.tree.Remove(entries...)
+}
+
+func (self *guarded) InsertChecked(entries ...r.Entry) error {
+	entries = slices.Clone(entries)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return self.tree.InsertChecked(entries...)
+}
+
+func (self *guarded) RemoveChecked(entries ...r.Entry) error {
+	entries = slices.Clone(entries)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return self.tree.RemoveChecked(entries...)
+}
+
+func (self *guarded) Update(old, entry r.Entry) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return self.tree.Update(old, entry)
+}
+
+func (self *guarded) RemoveRange(query r.Query) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return self.tree.RemoveRange(query)
+}
+
+func (self *guarded) Clear() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.tree.Clear()
+}
+
+func (self *guarded) GetRange(query r.Query) []r.Entry {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.tree.GetRange(query)
+}
+
+/*
+the first page Range reads, each one after is twice as large up to
+maxRangePage so stopping early stays cheap and long scans take the lock
+rarely
+*/
+const (
+	minRangePage = 16
+	maxRangePage = 1024
+)
+
+/*
+Reads the matches a page at a time, see guarded.  Entries written between
+pages are seen or not as they would be by Page.
+*/
+func (self *guarded) Range(query r.Query, fn func(r.Entry) bool) {
+	var page []r.Entry
+	cursor := r.Cursor{}
+	for limit := minRangePage; !cursor.Done(); limit = min(2*limit, maxRangePage) {
+		self.lock.RLock()
+		page, cursor = r.Page(self.tree, query, cursor, limit)
+		self.lock.RUnlock()
+
+		for _, entry := range page {
+			if !fn(entry) {
+				return
+			}
+		}
+	}
+}
+
+func (self *guarded) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.Range(query, yield)
+	}
+}
+
+func (self *guarded) Count(query r.Query) int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.tree.Count(query)
+}
+
+func (self *guarded) Get(coordinates ...int) []r.Entry {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.tree.Get(coordinates...)
+}
+
+func (self *guarded) Contains(entry r.Entry) bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.tree.Contains(entry)
+}
+
+func (self *guarded) Len() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.tree.Len()
+}
+
+func (self *guarded) All() []r.Entry {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return self.tree.All()
+}
+
+func (self *guarded) Copy() r.RangeTree {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return New(self.tree.Copy())
+}
+
+/*
+Wraps tree with a read/write mutex.  The caller must not use tree directly
+afterwards.
+*/
+func New(tree r.RangeTree) r.RangeTree {
+	return &guarded{tree: tree}
+}
+
+/*
+returned to write to throw away a copy that was left as it was
+*/
+var errUnchanged = errors.New(`unchanged`)
+
+/*
+copyOnWrite publishes immutable versions of a tree.  The published tree
+is never written to again, writers always work on a copy.
+*/
+type copyOnWrite struct {
+	lock    sync.Mutex // serializes writers
+	current atomic.Pointer[r.RangeTree]
+}
+
+func (self *copyOnWrite) load() r.RangeTree {
+	return *self.current.Load()
+}
+
+/*
+applies fn to a copy of the current tree and publishes the result, the
+copy is thrown away if fn returns an error
+*/
+func (self *copyOnWrite) write(fn func(tree r.RangeTree) error) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	tree := self.load().Copy()
+	if err := fn(tree); err != nil {
+		return err
+	}
+
+	self.current.Store(&tree)
+	return nil
+}
+
+func (self *copyOnWrite) Insert(entries ...r.Entry) {
+	if err := self.InsertChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *copyOnWrite) InsertChecked(entries ...r.Entry) error {
+	entries = slices.Clone(entries)
+	return self.write(func(tree r.RangeTree) error {
+		return tree.InsertChecked(entries...)
+	})
+}
+
+func (self *copyOnWrite) Remove(entries ...r.Entry) {
+	if err := self.RemoveChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *copyOnWrite) RemoveChecked(entries ...r.Entry) error {
+	entries = slices.Clone(entries)
+	return self.write(func(tree r.RangeTree) error {
+		return tree.RemoveChecked(entries...)
+	})
+}
+
+func (self *copyOnWrite) Update(old, entry r.Entry) bool {
+	found := false
+	self.write(func(tree r.RangeTree) error {
+		if found = tree.Update(old, entry); !found {
+			return errUnchanged
+		}
+		return nil
+	})
+
+	return found
+}
+
+func (self *copyOnWrite) RemoveRange(query r.Query) int {
+	removed := 0
+	self.write(func(tree r.RangeTree) error {
+		if removed = tree.RemoveRange(query); removed == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+
+	return removed
+}
+
+func (self *copyOnWrite) Clear() {
+	self.write(func(tree r.RangeTree) error {
+		tree.Clear()
+		return nil
+	})
+}
+
+func (self *copyOnWrite) GetRange(query r.Query) []r.Entry {
+	return self.load().GetRange(query)
+}
+
+func (self *copyOnWrite) Range(query r.Query, fn func(r.Entry) bool) {
+	self.load().Range(query, fn)
+}
+
+func (self *copyOnWrite) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.load().Range(query, yield)
+	}
+}
+
+func (self *copyOnWrite) Count(query r.Query) int {
+	return self.load().Count(query)
+}
+
+func (self *copyOnWrite) Get(coordinates ...int) []r.Entry {
+	return self.load().Get(coordinates...)
+}
+
+func (self *copyOnWrite) Contains(entry r.Entry) bool {
+	return self.load().Contains(entry)
+}
+
+func (self *copyOnWrite) Len() int {
+	return self.load().Len()
+}
+
+func (self *copyOnWrite) All() []r.Entry {
+	return self.load().All()
+}
+
+/*
+The published version is immutable so the copy can share it until its
+first write.
+*/
+func (self *copyOnWrite) Copy() r.RangeTree {
+	cp := &copyOnWrite{}
+	cp.current.Store(self.current.Load())
+	return cp
+}
+
+/*
+Wraps tree so readers never block and never see a partial write.  The
+caller must not use tree directly afterwards.
+*/
+func NewCopyOnWrite(tree r.RangeTree) r.RangeTree {
+	cow := &copyOnWrite{}
+	cow.current.Store(&tree)
+	return cow
+}
@@ -0,0 +1,292 @@
+package concurrent
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/persistent"
+	"github.com/dzyp/data/trees/rangetree/rangetreetest"
+	"github.com/dzyp/data/trees/rangetree/v1"
+)
+
+type point struct {
+	coordinates [2]int
+}
+
+func (self *point) GetDimensionalValue(dimension int) int {
+	return self.coordinates[dimension-1]
+}
+
+func (self *point) MaxDimensions() int {
+	return len(self.coordinates)
+}
+
+func (self *point) Less(other r.Entry, dimension int) bool {
+	for i := 1; i <= dimension; i++ {
+		selfValue, otherValue := self.GetDimensionalValue(i), other.GetDimensionalValue(i)
+		if selfValue != otherValue {
+			return selfValue < otherValue
+		}
+	}
+
+	return false
+}
+
+func newPoint(x, y int) *point {
+	return &point{[2]int{x, y}}
+}
+
+type bound struct {
+	low, high int
+}
+
+func (self bound) Low() int {
+	return self.low
+}
+
+func (self bound) High() int {
+	return self.high
+}
+
+type query [2]bound
+
+func (self query) GetDimensionalBounds(dimension int) r.Bounds {
+	return self[dimension-1]
+}
+
+func newQuery(startRow, stopRow, startColumn, stopColumn int) query {
+	return query{bound{startRow, stopRow}, bound{startColumn, stopColumn}}
+}
+
+const (
+	numWriters = 8
+	numReaders = 8
+	numOps     = 300
+	maxColumn  = 50
+)
+
+/*
+each writer owns one row so the final contents are known no matter how
+the writes interleave
+*/
+func hammer(t *testing.T, tree r.RangeTree) {
+	var wg sync.WaitGroup
+	expected := make([]map[int]bool, numWriters)
+
+	for w := 0; w < numWriters; w++ {
+		expected[w] = make(map[int]bool)
+		wg.Add(1)
+		go func(row int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(row)))
+			for i := 0; i < numOps; i++ {
+				column := rnd.Intn(maxColumn)
+				if rnd.Intn(3) == 0 {
+					tree.Remove(tree.Get(row, column)...) // only this writer touches the row
+					delete(expected[row], column)
+				} else {
+					tree.Insert(newPoint(row, column), newPoint(row, column))
+					expected[row][column] = true
+				}
+			}
+		}(w)
+	}
+
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < numOps; i++ {
+				row := rnd.Intn(numWriters)
+				q := newQuery(row, row+1, 0, maxColumn)
+				for _, entry := range tree.GetRange(q) {
+					if entry.GetDimensionalValue(1) != row {
+						t.Errorf(`Expected row: %d, received: %d`, row, entry.GetDimensionalValue(1))
+					}
+				}
+
+				tree.Count(q)
+				tree.Get(row, rnd.Intn(maxColumn))
+				tree.Contains(newPoint(row, rnd.Intn(maxColumn)))
+				tree.Len()
+				for range tree.Iter(q) {
+					break
+				}
+				tree.Copy().All()
+			}
+		}(int64(i))
+	}
+
+	wg.Wait()
+
+	total := 0
+	for row, columns := range expected {
+		total += len(columns)
+		entries := tree.GetRange(newQuery(row, row+1, 0, maxColumn))
+		if len(entries) != len(columns) {
+			t.Errorf(`Expected len: %d, received: %d`, len(columns), len(entries))
+		}
+
+		for _, entry := range entries {
+			if !columns[entry.GetDimensionalValue(2)] {
+				t.Errorf(`Unexpected entry: %+v`, entry)
+			}
+		}
+	}
+
+	if tree.Len() != total {
+		t.Errorf(`Expected len: %d, received: %d`, total, tree.Len())
+	}
+}
+
+func TestGuardedConcurrentAccess(t *testing.T) {
+	hammer(t, New(v1.New(2)))
+}
+
+func TestCopyOnWriteConcurrentAccess(t *testing.T) {
+	hammer(t, NewCopyOnWrite(v1.New(2)))
+}
+
+func TestCopyOnWritePersistentConcurrentAccess(t *testing.T) {
+	hammer(t, NewCopyOnWrite(persistent.Wrap(persistent.New(2))))
+}
+
+func TestCopyOnWriteReaderSeesOldVersion(t *testing.T) {
+	tree := NewCopyOnWrite(v1.New(2, newPoint(0, 0)))
+
+	visited := 0
+	tree.Range(newQuery(0, 10, 0, 10), func(entry r.Entry) bool {
+		tree.Insert(newPoint(1, 1)) // writers don't wait for readers
+		visited++
+		return true
+	})
+
+	if visited != 1 {
+		t.Errorf(`Expected visited: %d, received: %d`, 1, visited)
+	}
+
+	if tree.Len() != 2 {
+		t.Errorf(`Expected len: %d, received: %d`, 2, tree.Len())
+	}
+}
+
+func TestGuardedCallbackMayReadWithWriterWaiting(t *testing.T) {
+	tree := New(v1.New(2, newPoint(0, 0), newPoint(1, 1)))
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for range tree.Iter(newQuery(0, 10, 0, 10)) {
+			written := make(chan struct{})
+			go func() {
+				tree.Insert(newPoint(2, 2))
+				close(written)
+			}()
+
+			time.Sleep(10 * time.Millisecond) // let the writer queue up
+			tree.Len()
+			<-written
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Expected a read within Range not to deadlock.`)
+	}
+
+	if tree.Len() != 3 {
+		t.Errorf(`Expected len: %d, received: %d`, 3, tree.Len())
+	}
+}
+
+func TestCopiesAreIndependent(t *testing.T) {
+	for _, tree := range []r.RangeTree{
+		New(v1.New(2, newPoint(0, 0))),
+		NewCopyOnWrite(v1.New(2, newPoint(0, 0))),
+	} {
+		cp := tree.Copy()
+		tree.Insert(newPoint(1, 1))
+		cp.Clear()
+
+		if tree.Len() != 2 {
+			t.Errorf(`Expected len: %d, received: %d`, 2, tree.Len())
+		}
+
+		if cp.Len() != 0 {
+			t.Errorf(`Expected len: %d, received: %d`, 0, cp.Len())
+		}
+	}
+}
+
+func TestInsertDoesNotSortCallerSlice(t *testing.T) {
+	entries := []r.Entry{newPoint(2, 0), newPoint(1, 0), newPoint(0, 0)}
+	New(v1.New(2)).Insert(entries...)
+
+	for i, entry := range entries {
+		if entry.GetDimensionalValue(1) != 2-i {
+			t.Errorf(`Expected x: %d, received: %d`, 2-i, entry.GetDimensionalValue(1))
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	p := newPoint(0, 0)
+	for _, tree := range []r.RangeTree{
+		New(v1.New(2, p)),
+		NewCopyOnWrite(v1.New(2, p)),
+	} {
+		if !tree.Update(p, newPoint(3, 3)) {
+			t.Errorf(`Expected to find (0, 0).`)
+		}
+
+		if tree.Update(p, newPoint(4, 4)) {
+			t.Errorf(`Expected not to find (0, 0) again.`)
+		}
+
+		if tree.Len() != 1 || len(tree.Get(3, 3)) != 1 {
+			t.Errorf(`Expected only (3, 3), received: %+v`, tree.All())
+		}
+	}
+}
+
+func TestRemoveRange(t *testing.T) {
+	for _, tree := range []r.RangeTree{
+		New(v1.New(2, newPoint(0, 0), newPoint(1, 1), newPoint(5, 5))),
+		NewCopyOnWrite(v1.New(2, newPoint(0, 0), newPoint(1, 1), newPoint(5, 5))),
+	} {
+		if removed := tree.RemoveRange(newQuery(0, 2, 0, 2)); removed != 2 {
+			t.Errorf(`Expected removed: %d, received: %d`, 2, removed)
+		}
+
+		if removed := tree.RemoveRange(newQuery(0, 2, 0, 2)); removed != 0 {
+			t.Errorf(`Expected removed: %d, received: %d`, 0, removed)
+		}
+
+		if tree.Len() != 1 {
+			t.Errorf(`Expected len: %d, received: %d`, 1, tree.Len())
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	rangetreetest.RunConformance(t, func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+		return New(v1.New(maxDimensions, entries...))
+	})
+}
+
+func TestConformanceWithModes(t *testing.T) {
+	rangetreetest.RunConformanceWithModes(t, func(maxDimensions int, mode r.DuplicateMode, entries ...r.Entry) r.RangeTree {
+		return New(v1.NewWithOptions(maxDimensions, v1.Options{Duplicates: mode}, entries...))
+	})
+}
+
+func TestCopyOnWriteConformance(t *testing.T) {
+	rangetreetest.RunConformance(t, func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+		return NewCopyOnWrite(v1.New(maxDimensions, entries...))
+	})
+}
@@ -1,10 +1,79 @@
 package current
 
 import (
+	"cmp"
+	"fmt"
+
+	"github.com/dzyp/data/trees/kdtree"
 	rt "github.com/dzyp/data/trees/rangetree"
 	"github.com/dzyp/data/trees/rangetree/v1"
+	"github.com/dzyp/data/trees/rangetree/v2"
 )
 
+/*
+From this many dimensions on New and NewSorted return a kd-tree, whose
+O(n) space beats the O(n log^(d-1) n) of the layered tree.  In exchange a
+query visits O(n^(1-1/d) + k) nodes, and Range allocates a heap of the
+subtrees it has yet to enter, about O(n^(1-1/d)) of them, to keep to the
+order of Compare.  Call v1.New or v1.NewSorted directly to keep the
+layered tree.
+*/
+const KDTreeDimensions = 4
+
+/*
+Returns the current range tree for the number of dimensions, the layered
+v1 tree up to KDTreeDimensions and a kd-tree from there on.
+*/
 func New(maxDimensions int, entries ...rt.Entry) rt.RangeTree {
+	if maxDimensions >= KDTreeDimensions {
+		return kdtree.New(maxDimensions, entries...)
+	}
+
 	return v1.New(maxDimensions, entries...)
 }
+
+/*
+Builds the current range tree from entries already sorted by dimension 1,
+then dimension 2 and so on, the same tree New would return.  The layered
+tree is built without sorting them again, a kd-tree chooses its own
+splits and only checks the order, failing with v1.ErrUnsorted alike.
+*/
+func NewSorted(maxDimensions int, entries []rt.Entry) (rt.RangeTree, error) {
+	if maxDimensions >= KDTreeDimensions {
+		return newSortedKDTree(maxDimensions, entries)
+	}
+
+	tree, err := v1.NewSorted(maxDimensions, v1.Options{}, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+func newSortedKDTree(maxDimensions int, entries []rt.Entry) (rt.RangeTree, error) {
+	if err := rt.ValidateEntries(maxDimensions, entries...); err != nil {
+		return nil, err
+	}
+
+	for i := 1; i < len(entries); i++ {
+		if rt.Compare(entries[i-1], entries[i], maxDimensions) > 0 {
+			return nil, fmt.Errorf(`%w: entry %d comes before entry %d`, v1.ErrUnsorted, i, i-1)
+		}
+	}
+
+	tree, err := kdtree.NewChecked(maxDimensions, kdtree.Options{}, entries...)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+/*
+Returns the current generic range tree, keyed on any ordered type and
+carrying a typed payload.
+*/
+func NewGeneric[K cmp.Ordered, V any](maxDimensions int, entries ...v2.Entry[K, V]) v2.RangeTree[K, V] {
+	return v2.New(maxDimensions, entries...)
+}
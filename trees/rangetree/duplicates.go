@@ -0,0 +1,75 @@
+package rangetree
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+DuplicateMode decides what a tree does with entries that share every
+coordinate.
+*/
+type DuplicateMode int
+
+const (
+	/*
+		The entry inserted last wins, an insert at occupied coordinates
+		replaces the entry there.  This is the default.
+	*/
+	Replace DuplicateMode = iota
+	/*
+		The entry inserted first wins, an insert at occupied coordinates
+		is ignored.
+	*/
+	Set
+	/*
+		Every entry is kept.
+	*/
+	Multiset
+)
+
+func (self DuplicateMode) String() string {
+	switch self {
+	case Replace:
+		return `Replace`
+	case Set:
+		return `Set`
+	case Multiset:
+		return `Multiset`
+	}
+
+	return fmt.Sprintf(`DuplicateMode(%d)`, int(self))
+}
+
+/*
+Equaler may be implemented by entries to decide which entry a Remove
+refers to, for instance by comparing IDs.
+*/
+type Equaler interface {
+	Equal(other Entry) bool
+}
+
+/*
+Returns true if a and b are the same entry, which is what Remove and
+Contains look for in every mode rather than anything at the same
+coordinates.  If a implements Equaler it decides, otherwise the entries
+are compared with ==, which is pointer equality for pointer entries.
+Entries of a type that can't be compared with ==, such as a slice, are
+the same if their coordinates are.
+*/
+func SameEntry(a, b Entry) bool {
+	if equaler, ok := a.(Equaler); ok {
+		return equaler.Equal(b)
+	}
+
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return a == b
+	}
+
+	if !reflect.ValueOf(a).Comparable() || !reflect.ValueOf(b).Comparable() {
+		return a.MaxDimensions() == b.MaxDimensions() &&
+			Compare(a, b, a.MaxDimensions()) == 0
+	}
+
+	return a == b
+}
@@ -0,0 +1,61 @@
+package rangetree
+
+import "testing"
+
+type named struct {
+	name string
+}
+
+func (named) GetDimensionalValue(dimension int) int { return 0 }
+func (named) MaxDimensions() int                    { return 1 }
+func (named) Less(other Entry, dimension int) bool  { return false }
+
+type unhashable struct {
+	named
+	tags []string
+}
+
+type byName struct {
+	unhashable
+}
+
+func (self byName) Equal(other Entry) bool {
+	o, ok := other.(byName)
+	return ok && o.name == self.name
+}
+
+type cell []int
+
+func (self cell) GetDimensionalValue(dimension int) int { return self[dimension-1] }
+func (self cell) MaxDimensions() int                    { return len(self) }
+func (self cell) Less(other Entry, dimension int) bool  { return Compare(self, other, dimension) < 0 }
+
+func TestSameEntry(t *testing.T) {
+	a, b := &named{`a`}, &named{`a`}
+
+	if !SameEntry(a, a) || SameEntry(a, b) {
+		t.Errorf(`Expected pointers to compare by identity.`)
+	}
+
+	if !SameEntry(named{`a`}, named{`a`}) || SameEntry(named{`a`}, named{`b`}) {
+		t.Errorf(`Expected values to compare with ==.`)
+	}
+
+	x := byName{unhashable{named{`x`}, []string{`1`}}}
+	y := byName{unhashable{named{`x`}, []string{`2`}}}
+	if !SameEntry(x, y) {
+		t.Errorf(`Expected Equal to decide.`)
+	}
+
+	if !SameEntry(unhashable{}, unhashable{}) {
+		t.Errorf(`Expected incomparable entries to compare by coordinates.`)
+	}
+
+	if !SameEntry(cell{1, 2}, cell{1, 2}) || SameEntry(cell{1, 2}, cell{2, 1}) {
+		t.Errorf(`Expected slices to compare by coordinates.`)
+	}
+
+	if SameEntry(cell{0}, named{}) || SameEntry(cell{0}, nil) || !SameEntry(nil, nil) {
+		t.Errorf(`Expected different types never to be the same.`)
+	}
+}
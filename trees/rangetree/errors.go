@@ -0,0 +1,72 @@
+package rangetree
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+The errors returned by the checked methods of a RangeTree, match them
+with errors.Is.
+*/
+var (
+	ErrNilEntry          = errors.New(`rangetree: nil entry`)
+	ErrDimensionMismatch = errors.New(`rangetree: entry dimensions do not match the tree`)
+	ErrInconsistentOrder = errors.New(`rangetree: entry Less is inconsistent with its dimensional values`)
+	ErrInvalidDimension  = errors.New(`rangetree: dimension out of range`)
+	ErrNotShiftable      = errors.New(`rangetree: entry does not implement Shifter`)
+)
+
+/*
+Returns an error if any entry is nil or does not have exactly
+maxDimensions dimensions.
+*/
+func ValidateEntries(maxDimensions int, entries ...Entry) error {
+	for i, entry := range entries {
+		if entry == nil {
+			return fmt.Errorf(`%w: entry %d`, ErrNilEntry, i)
+		}
+
+		if entry.MaxDimensions() != maxDimensions {
+			return fmt.Errorf(
+				`%w: entry %d has %d dimensions, the tree has %d`,
+				ErrDimensionMismatch, i, entry.MaxDimensions(), maxDimensions,
+			)
+		}
+	}
+
+	return nil
+}
+
+/*
+Returns an error if entries, sorted with their Less method, are not in
+order of their dimensional values compared one dimension at a time.
+*/
+func ValidateOrder(maxDimensions int, entries []Entry) error {
+	for i := 1; i < len(entries); i++ {
+		if Compare(entries[i-1], entries[i], maxDimensions) > 0 {
+			return fmt.Errorf(
+				`%w: entry %d sorted after entry %d`, ErrInconsistentOrder, i-1, i,
+			)
+		}
+	}
+
+	return nil
+}
+
+/*
+Compares the dimensional values of two entries one dimension at a time,
+from dimension 1 up to and including maxDimensions.  Returns -1, 0 or 1.
+*/
+func Compare(a, b Entry, maxDimensions int) int {
+	for dimension := 1; dimension <= maxDimensions; dimension++ {
+		aValue, bValue := a.GetDimensionalValue(dimension), b.GetDimensionalValue(dimension)
+		if aValue < bValue {
+			return -1
+		} else if aValue > bValue {
+			return 1
+		}
+	}
+
+	return 0
+}
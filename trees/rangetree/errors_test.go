@@ -0,0 +1,69 @@
+package rangetree
+
+import (
+	"errors"
+	"testing"
+)
+
+type point []int
+
+func (self point) GetDimensionalValue(dimension int) int {
+	return self[dimension-1]
+}
+
+func (self point) MaxDimensions() int {
+	return len(self)
+}
+
+func (self point) Less(entry Entry, dimension int) bool {
+	return Compare(self, entry, dimension) < 0
+}
+
+func TestValidateEntries(t *testing.T) {
+	if err := ValidateEntries(2, point{0, 0}, point{1, 2}); err != nil {
+		t.Errorf(`Unexpected error: %v`, err)
+	}
+
+	if err := ValidateEntries(2, point{0, 0}, nil); !errors.Is(err, ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+
+	err := ValidateEntries(2, point{0, 0}, point{0, 0, 0})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	sorted := []Entry{point{0, 1}, point{0, 2}, point{1, 0}, point{1, 0}}
+	if err := ValidateOrder(2, sorted); err != nil {
+		t.Errorf(`Unexpected error: %v`, err)
+	}
+
+	unsorted := []Entry{point{0, 1}, point{0, 0}}
+	if err := ValidateOrder(2, unsorted); !errors.Is(err, ErrInconsistentOrder) {
+		t.Errorf(`Expected inconsistent order, received: %v`, err)
+	}
+
+	if err := ValidateOrder(1, unsorted); err != nil {
+		t.Errorf(`Unexpected error: %v`, err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b     point
+		expected int
+	}{
+		{point{0, 0}, point{0, 0}, 0},
+		{point{0, 5}, point{1, 0}, -1},
+		{point{1, 0}, point{0, 5}, 1},
+		{point{1, 2}, point{1, 3}, -1},
+	}
+
+	for _, c := range cases {
+		if result := Compare(c.a, c.b, 2); result != c.expected {
+			t.Errorf(`Expected %d comparing %v and %v, received: %d`, c.expected, c.a, c.b, result)
+		}
+	}
+}
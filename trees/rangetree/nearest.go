@@ -0,0 +1,175 @@
+package rangetree
+
+import (
+	"math"
+	"slices"
+)
+
+/*
+Metric measures the distance from a point to an entry.  Nearest relies on
+it never being less than the Chebyshev distance, the largest difference
+in any one dimension, which holds for Manhattan, Euclidean and every other
+Lp norm.
+*/
+type Metric func(point []int, entry Entry) float64
+
+/*
+The sum of the differences in each dimension.
+*/
+func Manhattan(point []int, entry Entry) float64 {
+	distance := 0.
+	for i, value := range point {
+		distance += math.Abs(float64(entry.GetDimensionalValue(i+1)) - float64(value))
+	}
+
+	return distance
+}
+
+/*
+The largest difference in any one dimension.
+*/
+func Chebyshev(point []int, entry Entry) float64 {
+	distance := 0.
+	for i, value := range point {
+		distance = max(distance, math.Abs(float64(entry.GetDimensionalValue(i+1))-float64(value)))
+	}
+
+	return distance
+}
+
+/*
+The straight line distance.
+*/
+func Euclidean(point []int, entry Entry) float64 {
+	distance := 0.
+	for i, value := range point {
+		difference := float64(entry.GetDimensionalValue(i+1)) - float64(value)
+		distance += difference * difference
+	}
+
+	return math.Sqrt(distance)
+}
+
+/*
+the query holding every value within radius of point in each dimension,
+clamped rather than overflowing at the ends of int.  A radius of
+math.MaxInt can't reach from one end of int to the other, it is taken to
+mean the whole space.
+*/
+func box(point []int, radius int) Query {
+	if radius == math.MaxInt {
+		return NewQuery()
+	}
+
+	bounds := make([]Bounds, len(point))
+	for i, value := range point {
+		low, high := math.MinInt, math.MaxInt
+		if value > math.MinInt+radius {
+			low = value - radius
+		}
+		if value < math.MaxInt-radius {
+			high = value + radius
+		}
+
+		bounds[i] = Closed(low, high)
+	}
+
+	return NewQuery(bounds...)
+}
+
+type neighbour struct {
+	entry    Entry
+	distance float64
+}
+
+/*
+returns the k entries within the query nearest to point, nearest first.
+Only the k nearest seen so far are kept, each entry Range visits is
+inserted after those no farther than it so ties stay in the order Range
+visits them.
+*/
+func nearestWithin(tree Reader, query Query, point []int, k int, metric Metric) []neighbour {
+	neighbours := make([]neighbour, 0, k)
+	tree.Range(query, func(entry Entry) bool {
+		distance := metric(point, entry)
+		i, _ := slices.BinarySearchFunc(neighbours, distance, func(n neighbour, distance float64) int {
+			if n.distance <= distance {
+				return -1
+			}
+			return 1
+		})
+
+		if i == k {
+			return true
+		}
+
+		if len(neighbours) == k {
+			neighbours = neighbours[:k-1]
+		}
+		neighbours = slices.Insert(neighbours, i, neighbour{entry, distance})
+		return true
+	})
+
+	return neighbours
+}
+
+/*
+the number of dimensions of the entries in the tree, which are all the
+same, or 0 for an empty tree
+*/
+func dimensions(tree Reader) int {
+	dimensions := 0
+	tree.Range(NewQuery(), func(entry Entry) bool {
+		dimensions = entry.MaxDimensions()
+		return false
+	})
+
+	return dimensions
+}
+
+/*
+Returns the k entries nearest to point under metric, nearest first and
+ties in the order of Compare.  point holds a value for each dimension,
+starting with dimension 1, nil is returned if it holds any other number.
+
+The search grows a square around point, doubling its radius until it
+holds k entries.  The farthest of the k nearest in that square bounds the
+distance of the true k nearest.  If that reaches past the square, one last
+square of that radius is searched.  Each square is a plain range query.
+*/
+func Nearest(tree Reader, point []int, k int, metric Metric) []Entry {
+	if k <= 0 || len(point) == 0 || len(point) != dimensions(tree) {
+		return nil
+	}
+	k = min(k, tree.Len())
+
+	radius := 1
+	for tree.Count(box(point, radius)) < k {
+		if radius > math.MaxInt/2 {
+			radius = math.MaxInt
+			break
+		}
+		radius *= 2
+	}
+
+	neighbours := nearestWithin(tree, box(point, radius), point, k, metric)
+	if len(neighbours) == 0 {
+		return nil
+	}
+
+	// entries just outside the square may still beat those in its corners
+	if farthest := neighbours[len(neighbours)-1].distance; farthest > float64(radius) {
+		radius = math.MaxInt
+		if farthest < math.MaxInt/2 {
+			radius = int(math.Ceil(farthest))
+		}
+		neighbours = nearestWithin(tree, box(point, radius), point, k, metric)
+	}
+
+	entries := make([]Entry, len(neighbours))
+	for i, neighbour := range neighbours {
+		entries[i] = neighbour.entry
+	}
+
+	return entries
+}
@@ -0,0 +1,136 @@
+package rangetree_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/v1"
+)
+
+/*
+an entry of one dimension
+*/
+type line struct {
+	value int
+}
+
+func (self *line) GetDimensionalValue(dimension int) int {
+	return self.value
+}
+
+func (self *line) MaxDimensions() int {
+	return 1
+}
+
+func (self *line) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+func bruteForceNearest(entries []r.Entry, point []int, k int, metric r.Metric) []float64 {
+	distances := make([]float64, len(entries))
+	for i, entry := range entries {
+		distances[i] = metric(point, entry)
+	}
+
+	slices.Sort(distances)
+	return distances[:min(k, len(distances))]
+}
+
+func TestNearestMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(47))
+	entries := make([]r.Entry, 0, 300)
+	for i := 0; i < 300; i++ {
+		entries = append(entries, newCell(rnd.Intn(200)-100, rnd.Intn(200)-100))
+	}
+	tree := v1.New(2, entries...)
+	entries = tree.All()
+
+	metrics := map[string]r.Metric{
+		`manhattan`: r.Manhattan,
+		`chebyshev`: r.Chebyshev,
+		`euclidean`: r.Euclidean,
+	}
+
+	for name, metric := range metrics {
+		for i := 0; i < 30; i++ {
+			point := []int{rnd.Intn(300) - 150, rnd.Intn(300) - 150}
+			k := rnd.Intn(20) + 1
+
+			expected := bruteForceNearest(entries, point, k, metric)
+			received := r.Nearest(tree, point, k, metric)
+			if len(received) != len(expected) {
+				t.Fatalf(`%s: expected len: %d, received: %d`, name, len(expected), len(received))
+			}
+
+			for j, entry := range received {
+				if distance := metric(point, entry); distance != expected[j] {
+					t.Errorf(`%s: expected distance: %v at %d, received: %v`, name, expected[j], j, distance)
+				}
+			}
+		}
+	}
+}
+
+func TestNearestEdgeCases(t *testing.T) {
+	tree := v1.New(2, newCell(0, 0), newCell(5, 5))
+
+	if entries := r.Nearest(tree, []int{1, 1}, 0, r.Euclidean); entries != nil {
+		t.Errorf(`Expected nil for k of zero, received: %+v`, entries)
+	}
+
+	if entries := r.Nearest(v1.New(2), []int{1, 1}, 3, r.Euclidean); entries != nil {
+		t.Errorf(`Expected nil for an empty tree, received: %+v`, entries)
+	}
+
+	entries := r.Nearest(tree, []int{4, 4}, 5, r.Euclidean)
+	if len(entries) != 2 || entries[0].GetDimensionalValue(1) != 5 {
+		t.Errorf(`Expected (5, 5) then (0, 0), received: %+v`, entries)
+	}
+
+	if entries := r.Nearest(tree, []int{1 << 62, -1 << 62}, 1, r.Manhattan); len(entries) != 1 {
+		t.Errorf(`Expected a far away point to find one entry, received: %+v`, entries)
+	}
+
+	// farther than any radius short of the whole space
+	extreme := v1.New(1, &line{math.MinInt})
+	if entries := r.Nearest(extreme, []int{5}, 1, r.Euclidean); len(entries) != 1 {
+		t.Errorf(`Expected an entry at the end of int to be found, received: %+v`, entries)
+	}
+}
+
+func TestNearestChecksDimensions(t *testing.T) {
+	tree := v1.New(2, newCell(0, 0), newCell(5, 5))
+
+	for _, point := range [][]int{{1}, {1, 1, 1}} {
+		if entries := r.Nearest(tree, point, 1, r.Euclidean); entries != nil {
+			t.Errorf(`Expected nil for a point of %d dimensions, received: %+v`, len(point), entries)
+		}
+	}
+}
+
+func TestNearestKeepsOnlyK(t *testing.T) {
+	tree := v1.New(2)
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			tree.Insert(newCell(x, y))
+		}
+	}
+
+	// a point far from the entries grows a square holding all of them
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	entries := r.Nearest(tree, []int{1000, 1000}, 3, r.Chebyshev)
+	runtime.ReadMemStats(&after)
+
+	if len(entries) != 3 {
+		t.Fatalf(`Expected len: %d, received: %d`, 3, len(entries))
+	}
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<14 {
+		t.Errorf(`Expected memory independent of the entries searched, received: %d bytes`, allocated)
+	}
+}
@@ -0,0 +1,127 @@
+package rangetree
+
+import "math"
+
+/*
+Cursor marks where a page of results ended, pass it to the next call to
+Page to continue from there.  The zero value starts from the beginning.
+
+A cursor holds the coordinates of the last entry returned and how many
+entries at those coordinates were returned, it holds no reference into
+the tree.  It stays valid however the tree changes: the next page holds
+the entries that come after those coordinates in Compare order when it is
+read, so entries inserted behind the cursor are not seen and ones inserted
+ahead of it are.  Entries sharing the cursor's coordinates in a multiset
+tree are resumed by position, removing one of them shifts that position.
+*/
+type Cursor struct {
+	coordinates []int
+	seen        int
+	done        bool
+}
+
+/*
+Returns true if the page this cursor came from was the last one.
+*/
+func (self Cursor) Done() bool {
+	return self.done
+}
+
+/*
+a query narrowed to the entries after a cursor that share its first
+dimensions
+*/
+type pageQuery struct {
+	query       Query
+	coordinates []int
+	dimension   int // dimensions before this one equal the cursor
+	exact       bool
+}
+
+func (self *pageQuery) GetDimensionalBounds(dimension int) Bounds {
+	low, high := Inclusive(self.query.GetDimensionalBounds(dimension))
+	value := self.coordinates[dimension-1]
+
+	switch {
+	case dimension < self.dimension || dimension == self.dimension && self.exact:
+		low, high = max(low, value), min(high, value)
+	case dimension == self.dimension:
+		if value == math.MaxInt {
+			return interval{math.MaxInt, math.MinInt}
+		}
+		low = max(low, value+1)
+	}
+
+	return interval{low, high}
+}
+
+/*
+Returns up to limit entries within the query, in the order Range visits
+them, starting after cursor.  The returned cursor resumes after the last
+of them.  Earlier pages are not scanned again: the remainder of the query
+is split into one query per dimension, those sharing the cursor's first
+dimensions and passing it in the next, each visited only as far as
+needed.  That takes a Range which finds its entries as it goes rather than
+gathering them first, as every tree in this module does.  On a tree
+wrapped for concurrent use every one of those queries sees whatever
+version is current when it runs.
+*/
+func Page(tree Reader, query Query, cursor Cursor, limit int) ([]Entry, Cursor) {
+	if cursor.done || limit <= 0 {
+		return nil, cursor
+	}
+
+	entries := make([]Entry, 0, limit)
+	more := false
+	next := cursor
+
+	visit := func(entry Entry) bool {
+		if len(entries) == limit {
+			more = true
+			return false
+		}
+
+		entries = append(entries, entry)
+		if next.coordinates == nil || Compare(entry, Coordinates(next.coordinates), len(next.coordinates)) != 0 {
+			next = Cursor{coordinates: coordinatesOf(entry)}
+		}
+		next.seen++
+
+		return true
+	}
+
+	if cursor.coordinates == nil {
+		tree.Range(query, visit)
+		next.done = !more
+		return entries, next
+	}
+
+	maxDimensions := len(cursor.coordinates)
+
+	// the rest of the entries at the cursor itself, then those past it
+	skip := cursor.seen
+	tree.Range(&pageQuery{query, cursor.coordinates, maxDimensions, true}, func(entry Entry) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+
+		return visit(entry)
+	})
+
+	for dimension := maxDimensions; dimension >= 1 && !more; dimension-- {
+		tree.Range(&pageQuery{query, cursor.coordinates, dimension, false}, visit)
+	}
+
+	next.done = !more
+	return entries, next
+}
+
+func coordinatesOf(entry Entry) []int {
+	result := make([]int, entry.MaxDimensions())
+	for i := range result {
+		result[i] = entry.GetDimensionalValue(i + 1)
+	}
+
+	return result
+}
@@ -0,0 +1,184 @@
+package rangetree_test
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/dzyp/data/trees/kdtree"
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/concurrent"
+	"github.com/dzyp/data/trees/rangetree/persistent"
+	"github.com/dzyp/data/trees/rangetree/static"
+	"github.com/dzyp/data/trees/rangetree/v1"
+)
+
+type cell struct {
+	coordinates [2]int
+}
+
+func (self *cell) GetDimensionalValue(dimension int) int {
+	return self.coordinates[dimension-1]
+}
+
+func (self *cell) MaxDimensions() int {
+	return len(self.coordinates)
+}
+
+func (self *cell) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+func newCell(x, y int) *cell {
+	return &cell{[2]int{x, y}}
+}
+
+func pageAll(tree r.Reader, q r.Query, limit int) []r.Entry {
+	result := make([]r.Entry, 0)
+	var cursor r.Cursor
+	for !cursor.Done() {
+		var page []r.Entry
+		page, cursor = r.Page(tree, q, cursor, limit)
+		if len(page) > limit {
+			panic(`page over limit`)
+		}
+		result = append(result, page...)
+	}
+
+	return result
+}
+
+func checkSame(t *testing.T, expected, received []r.Entry) {
+	if len(expected) != len(received) {
+		t.Errorf(`Expected len: %d, received: %d`, len(expected), len(received))
+		return
+	}
+
+	for i := range expected {
+		if expected[i] != received[i] {
+			t.Errorf(`Expected: %+v at %d, received: %+v`, expected[i], i, received[i])
+		}
+	}
+}
+
+func TestPageMatchesRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(43))
+	entries := make([]r.Entry, 0, 400)
+	for i := 0; i < 400; i++ {
+		entries = append(entries, newCell(rnd.Intn(30), rnd.Intn(30)))
+	}
+
+	for _, tree := range []r.Reader{
+		v1.New(2, entries...),
+		v1.NewWithOptions(2, v1.Options{Duplicates: r.Multiset}, entries...),
+		persistent.Wrap(persistent.New(2, entries...)),
+		concurrent.New(v1.New(2, entries...)),
+		kdtree.NewWithOptions(2, kdtree.Options{Duplicates: r.Multiset}, entries...),
+		static.NewWithOptions(2, static.Options{Duplicates: r.Multiset}, entries...),
+	} {
+		for i := 0; i < 20; i++ {
+			x, y := rnd.Intn(30), rnd.Intn(30)
+			q := r.NewQuery(r.HalfOpen(x, x+rnd.Intn(30)), r.HalfOpen(y, y+rnd.Intn(30)))
+
+			for _, limit := range []int{1, 3, 7, 500} {
+				checkSame(t, tree.GetRange(q), pageAll(tree, q, limit))
+			}
+		}
+	}
+}
+
+func TestPageDone(t *testing.T) {
+	tree := v1.New(2, newCell(0, 0), newCell(0, 1), newCell(1, 0), newCell(1, 1))
+	q := r.NewQuery(r.HalfOpen(0, 10), r.HalfOpen(0, 10))
+
+	page, cursor := r.Page(tree, q, r.Cursor{}, 2)
+	if len(page) != 2 || cursor.Done() {
+		t.Errorf(`Expected a full page with more to come, received: %d, %t`, len(page), cursor.Done())
+	}
+
+	page, cursor = r.Page(tree, q, cursor, 2)
+	if len(page) != 2 || !cursor.Done() {
+		t.Errorf(`Expected the last page, received: %d, %t`, len(page), cursor.Done())
+	}
+
+	if page, _ := r.Page(tree, q, cursor, 2); page != nil {
+		t.Errorf(`Expected nothing after the last page, received: %+v`, page)
+	}
+
+	if page, cursor := r.Page(v1.New(2), q, r.Cursor{}, 2); len(page) != 0 || !cursor.Done() {
+		t.Errorf(`Expected an empty tree to be done.`)
+	}
+}
+
+func TestPageAcrossWrites(t *testing.T) {
+	tree := v1.New(2)
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 5; y++ {
+			tree.Insert(newCell(x, y))
+		}
+	}
+	q := r.NewQuery(r.HalfOpen(0, 10), r.HalfOpen(0, 10))
+
+	page, cursor := r.Page(tree, q, r.Cursor{}, 8) // ends at (1, 2)
+	last := page[len(page)-1]
+
+	tree.Remove(last)
+	tree.Insert(newCell(0, 9), newCell(1, 3), newCell(1, 9), newCell(9, 0))
+
+	rest := make([]r.Entry, 0)
+	for !cursor.Done() {
+		page, cursor = r.Page(tree, q, cursor, 8)
+		rest = append(rest, page...)
+	}
+
+	expected := make([]r.Entry, 0)
+	tree.Range(q, func(entry r.Entry) bool {
+		if r.Compare(entry, last, 2) > 0 {
+			expected = append(expected, entry)
+		}
+		return true
+	})
+
+	checkSame(t, expected, rest)
+	for _, entry := range rest {
+		if entry.GetDimensionalValue(1) == 0 && entry.GetDimensionalValue(2) == 9 {
+			t.Errorf(`Expected an entry inserted behind the cursor not to be seen.`)
+		}
+	}
+}
+
+func TestPageDoesNotRescan(t *testing.T) {
+	rnd := rand.New(rand.NewSource(61))
+	entries := make([]r.Entry, 0, 1<<12)
+	for i := 0; i < 1<<12; i++ {
+		entries = append(entries, newCell(rnd.Intn(1<<10), rnd.Intn(1<<10)))
+	}
+
+	q := r.NewQuery(r.HalfOpen(0, 1<<10), r.HalfOpen(0, 1<<9))
+	for _, tree := range []r.Reader{
+		kdtree.New(2, entries...),
+		static.New(2, entries...),
+		concurrent.New(kdtree.New(2, entries...)),
+	} {
+		result := make([]r.Entry, 0)
+		var most uint64
+		for cursor := (r.Cursor{}); !cursor.Done(); {
+			var before, after runtime.MemStats
+			var page []r.Entry
+			runtime.ReadMemStats(&before)
+			page, cursor = r.Page(tree, q, cursor, 16)
+			runtime.ReadMemStats(&after)
+
+			result = append(result, page...)
+			most = max(most, after.TotalAlloc-before.TotalAlloc)
+		}
+
+		checkSame(t, tree.GetRange(q), result)
+
+		// gathering the rest of the query, a page at a time, would take 16
+		// bytes for each entry left
+		if most > uint64(4*len(entries)) {
+			t.Errorf(`%T: expected a page to allocate a fraction of the entries, received: %d bytes`, tree, most)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package persistent
+
+import (
+	"slices"
+	"sort"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+compares two entries on every dimension from the given dimension up to
+and including maxDimensions
+*/
+func compareEntries(a, b r.Entry, dimension, maxDimensions int) int {
+	for i := dimension; i <= maxDimensions; i++ {
+		aValue, bValue := a.GetDimensionalValue(i), b.GetDimensionalValue(i)
+		if aValue < bValue {
+			return -1
+		} else if aValue > bValue {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+/*
+returns a copy of the entries sorted on every dimension, entries with the
+same coordinates keep their relative order so the last one wins
+*/
+func sortEntries(entries []r.Entry, maxDimensions int) []r.Entry {
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, func(a, b r.Entry) int {
+		return compareEntries(a, b, 1, maxDimensions)
+	})
+
+	return sorted
+}
+
+/*
+a run of sorted entries sharing the same value in one dimension
+*/
+type group struct {
+	value   int
+	entries []r.Entry
+}
+
+func groupEntries(entries []r.Entry, dimension int) []group {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	groups := make([]group, 0)
+	lastIndex := 0
+	lastSeen := entries[0].GetDimensionalValue(dimension)
+
+	for i := 1; i < len(entries); i++ {
+		value := entries[i].GetDimensionalValue(dimension)
+		if value == lastSeen {
+			continue
+		}
+
+		groups = append(groups, group{lastSeen, entries[lastIndex:i]})
+		lastIndex = i
+		lastSeen = value
+	}
+
+	return append(groups, group{lastSeen, entries[lastIndex:]})
+}
+
+/*
+returns the index of the first group whose value is not less than value
+*/
+func findGroup(groups []group, value int) int {
+	return sort.Search(len(groups), func(i int) bool {
+		return groups[i].value >= value
+	})
+}
@@ -0,0 +1,856 @@
+/*
+Package persistent is an immutable range tree.  Insert and Remove leave
+the receiver untouched and return a new version of the tree, copying only
+the nodes on the paths they change.  Everything else, including the nested
+trees of later dimensions, is shared between versions so old versions stay
+queryable and taking a snapshot is free.
+
+The layout matches v1: one balanced tree per dimension over the distinct
+values in that dimension, whose leaves hold either an entry or the tree
+for the next dimension.  Entries with identical coordinates replace one
+another, while Remove and Contains match the exact entry given, see
+rangetree.SameEntry.  Nodes are kept weight balanced as in v1, a node on a changed
+path whose children grow too uneven is rebuilt, so across a sequence of
+versions each derived from the last a write copies O(log n) nodes per
+dimension, amortized.  Writing many times to one old version that is due
+a rebuild pays for that rebuild every time.
+*/
+package persistent
+
+import (
+	"iter"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+type node struct {
+	left        *node
+	right       *node
+	entry       r.Entry
+	value       int
+	numChildren int
+	rt          *Tree
+}
+
+func newNode(tree *Tree, groups []group) *node {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	if len(groups) == 1 {
+		n := &node{value: groups[0].value}
+		if tree.isLastDimension() {
+			n.entry = groups[0].entries[len(groups[0].entries)-1]
+		} else {
+			n.rt = new(tree.maxDimensions, tree.dimension+1, groups[0].entries)
+		}
+
+		return n
+	}
+
+	median := len(groups) / 2
+
+	return &node{
+		left:        newNode(tree, groups[0:median]),
+		right:       newNode(tree, groups[median:]),
+		value:       groups[median].value,
+		numChildren: len(groups),
+	}
+}
+
+/*
+A node is rebuilt when either child holds less than this share of its
+leaves, the default balance of v1.
+*/
+const balance float64 = .3
+
+func newInternalNode(value int, left, right *node) *node {
+	return &node{
+		left:        left,
+		right:       right,
+		value:       value,
+		numChildren: left.size() + right.size(),
+	}
+}
+
+/*
+newInternalNode for a node on a changed path, rebuilt into a perfectly
+balanced subtree if its children are too uneven.  Only new internal nodes
+are made, the leaves and the trees they hold are shared as they are.
+*/
+func newBalancedNode(value int, left, right *node) *node {
+	n := newInternalNode(value, left, right)
+	total := float64(n.numChildren)
+	if float64(left.size())/total >= balance && float64(right.size())/total >= balance {
+		return n
+	}
+
+	leaves := make([]*node, 0, n.numChildren)
+	n.leaves(func(leaf *node) {
+		leaves = append(leaves, leaf)
+	})
+
+	return buildFromLeaves(leaves)
+}
+
+func (self *node) leaves(fn func(*node)) {
+	if self.isLeaf() {
+		fn(self)
+		return
+	}
+
+	self.left.leaves(fn)
+	self.right.leaves(fn)
+}
+
+/*
+builds a balanced subtree over leaves already in order, splitting them
+the same way newNode splits groups
+*/
+func buildFromLeaves(leaves []*node) *node {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+
+	median := len(leaves) / 2
+
+	return newInternalNode(
+		leaves[median].value, buildFromLeaves(leaves[0:median]), buildFromLeaves(leaves[median:]),
+	)
+}
+
+func (self *node) isLeaf() bool {
+	return self.left == nil
+}
+
+/*
+returns the number of leaves this node contributes to its parent's
+numChildren, a leaf counts as one
+*/
+func (self *node) size() int {
+	if self.isLeaf() {
+		return 1
+	}
+
+	return self.numChildren
+}
+
+func (self *node) numEntries() int {
+	if self.isLeaf() {
+		if self.rt == nil {
+			return 1
+		}
+
+		return self.rt.numChildren
+	}
+
+	return self.left.numEntries() + self.right.numEntries()
+}
+
+func (self *node) all(fn func(r.Entry) bool) bool {
+	if self.isLeaf() {
+		if self.rt == nil {
+			return fn(self.entry)
+		}
+
+		return self.rt.all(fn)
+	}
+
+	return self.left.all(fn) && self.right.all(fn)
+}
+
+/*
+visits every entry below this node that falls within the query.  left is
+true when every value below this node is under the high bound and right is
+true when every value is at or above the low bound.
+*/
+func (self *node) getRange(tree *Tree, query r.Query, fn func(r.Entry) bool, left, right bool) bool {
+	low, high := r.Inclusive(query.GetDimensionalBounds(tree.dimension))
+	if self.isLeaf() {
+		if self.value < low || self.value > high {
+			return true
+		}
+
+		if self.rt == nil {
+			return fn(self.entry)
+		}
+
+		return self.rt.getRange(query, fn)
+	}
+
+	if high < self.value {
+		return self.left.getRange(tree, query, fn, left, right)
+	}
+
+	if low > self.value {
+		return self.right.getRange(tree, query, fn, left, right)
+	}
+
+	if left {
+		return self.left.getRange(tree, query, fn, true, false) &&
+			self.right.flatten(query, fn)
+	} else if right {
+		return self.left.flatten(query, fn) &&
+			self.right.getRange(tree, query, fn, false, true)
+	}
+
+	return self.left.getRange(tree, query, fn, true, false) &&
+		self.right.getRange(tree, query, fn, false, true)
+}
+
+func (self *node) flatten(query r.Query, fn func(r.Entry) bool) bool {
+	if self.isLeaf() {
+		if self.rt == nil {
+			return fn(self.entry)
+		}
+
+		return self.rt.getRange(query, fn)
+	}
+
+	return self.left.flatten(query, fn) && self.right.flatten(query, fn)
+}
+
+func (self *node) count(tree *Tree, query r.Query, left, right bool) int {
+	low, high := r.Inclusive(query.GetDimensionalBounds(tree.dimension))
+	if self.isLeaf() {
+		if self.value < low || self.value > high {
+			return 0
+		}
+
+		if self.rt == nil {
+			return 1
+		}
+
+		return self.rt.count(query)
+	}
+
+	if high < self.value {
+		return self.left.count(tree, query, left, right)
+	}
+
+	if low > self.value {
+		return self.right.count(tree, query, left, right)
+	}
+
+	if left {
+		return self.left.count(tree, query, true, false) +
+			self.right.countCovered(tree, query)
+	} else if right {
+		return self.left.countCovered(tree, query) +
+			self.right.count(tree, query, false, true)
+	}
+
+	return self.left.count(tree, query, true, false) +
+		self.right.count(tree, query, false, true)
+}
+
+func (self *node) countCovered(tree *Tree, query r.Query) int {
+	if tree.isLastDimension() {
+		return self.size()
+	}
+
+	if self.isLeaf() {
+		return self.rt.count(query)
+	}
+
+	return self.left.countCovered(tree, query) +
+		self.right.countCovered(tree, query)
+}
+
+/*
+descends from this node to the leaf holding value, returns nil if there
+isn't one
+*/
+func (self *node) find(value int) *node {
+	n := self
+	for !n.isLeaf() {
+		if value >= n.value {
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	if n.value != value {
+		return nil
+	}
+
+	return n
+}
+
+/*
+returns a new node with the groups inserted below it, along with the
+number of leaves added to this dimension and the number of entries added
+overall.  Subtrees that receive nothing are shared with the old node.
+*/
+func (self *node) insert(tree *Tree, groups []group) (*node, int, int) {
+	if len(groups) == 0 {
+		return self, 0, 0
+	}
+
+	index := findGroup(groups, self.value)
+
+	if !self.isLeaf() {
+		left, leftLeaves, leftEntries := self.left.insert(tree, groups[0:index])
+		right, rightLeaves, rightEntries := self.right.insert(tree, groups[index:])
+
+		return newBalancedNode(self.value, left, right),
+			leftLeaves + rightLeaves, leftEntries + rightEntries
+	}
+
+	low, high := groups[0:index], groups[index:]
+	leaf := self
+	added := 0
+
+	if len(high) > 0 && high[0].value == self.value {
+		leaf = &node{value: self.value}
+		if tree.isLastDimension() {
+			leaf.entry = high[0].entries[len(high[0].entries)-1]
+		} else {
+			leaf.rt = self.rt.insert(high[0].entries)
+			added += leaf.rt.numChildren - self.rt.numChildren
+		}
+
+		high = high[1:]
+	}
+
+	lowN, highN := newNode(tree, low), newNode(tree, high)
+
+	switch {
+	case lowN == nil && highN == nil:
+		return leaf, 0, added
+	case highN == nil:
+		return newBalancedNode(self.value, lowN, leaf),
+			lowN.size(), added + lowN.numEntries()
+	case lowN == nil:
+		return newBalancedNode(high[0].value, leaf, highN),
+			highN.size(), added + highN.numEntries()
+	}
+
+	right := newBalancedNode(high[0].value, leaf, highN)
+	return newBalancedNode(self.value, lowN, right),
+		lowN.size() + highN.size(),
+		added + lowN.numEntries() + highN.numEntries()
+}
+
+/*
+returns the node that replaces this one once the entry is removed, nil if
+the node is now empty, and whether anything was removed.  The node itself
+is returned when nothing changed.
+*/
+func (self *node) remove(tree *Tree, entry r.Entry) (*node, bool) {
+	value := entry.GetDimensionalValue(tree.dimension)
+
+	if self.isLeaf() {
+		if self.value != value {
+			return self, false
+		}
+
+		if self.rt == nil {
+			if !r.SameEntry(self.entry, entry) {
+				return self, false
+			}
+
+			return nil, true
+		}
+
+		rt := self.rt.remove(entry)
+		if rt == self.rt {
+			return self, false
+		}
+
+		if rt.numChildren == 0 {
+			return nil, true
+		}
+
+		return &node{value: self.value, rt: rt}, true
+	}
+
+	left, right := self.left, self.right
+	var removed bool
+	if value >= self.value {
+		right, removed = right.remove(tree, entry)
+	} else {
+		left, removed = left.remove(tree, entry)
+	}
+
+	if !removed {
+		return self, false
+	}
+
+	// a child emptied out, its sibling takes our place
+	if left == nil {
+		return right, true
+	} else if right == nil {
+		return left, true
+	}
+
+	return newBalancedNode(self.value, left, right), true
+}
+
+/*
+returns the node that replaces this one once the entries within the query
+are removed, nil if the node is now empty, and the number of entries
+removed.  The node itself is returned when nothing changed.
+*/
+func (self *node) removeRange(tree *Tree, query r.Query, left, right bool) (*node, int) {
+	low, high := r.Inclusive(query.GetDimensionalBounds(tree.dimension))
+	if self.isLeaf() {
+		if self.value < low || self.value > high {
+			return self, 0
+		}
+
+		return self.removeCovered(tree, query)
+	}
+
+	lowN, highN := self.left, self.right
+	var lowRemoved, highRemoved int
+
+	switch {
+	case high < self.value:
+		lowN, lowRemoved = self.left.removeRange(tree, query, left, right)
+	case low > self.value:
+		highN, highRemoved = self.right.removeRange(tree, query, left, right)
+	case left:
+		lowN, lowRemoved = self.left.removeRange(tree, query, true, false)
+		highN, highRemoved = self.right.removeCovered(tree, query)
+	case right:
+		lowN, lowRemoved = self.left.removeCovered(tree, query)
+		highN, highRemoved = self.right.removeRange(tree, query, false, true)
+	default:
+		lowN, lowRemoved = self.left.removeRange(tree, query, true, false)
+		highN, highRemoved = self.right.removeRange(tree, query, false, true)
+	}
+
+	return self.join(lowN, highN, lowRemoved+highRemoved), lowRemoved + highRemoved
+}
+
+/*
+removeRange for a node whose values all fall within the query in this
+dimension, in the last dimension the whole subtree goes at once
+*/
+func (self *node) removeCovered(tree *Tree, query r.Query) (*node, int) {
+	if tree.isLastDimension() {
+		return nil, self.size()
+	}
+
+	if self.isLeaf() {
+		rt, removed := self.rt.removeRange(query)
+		switch {
+		case removed == 0:
+			return self, 0
+		case rt.numChildren == 0:
+			return nil, removed
+		}
+
+		return &node{value: self.value, rt: rt}, removed
+	}
+
+	lowN, lowRemoved := self.left.removeCovered(tree, query)
+	highN, highRemoved := self.right.removeCovered(tree, query)
+
+	return self.join(lowN, highN, lowRemoved+highRemoved), lowRemoved + highRemoved
+}
+
+/*
+returns the node holding what is left of this node's children
+*/
+func (self *node) join(left, right *node, removed int) *node {
+	switch {
+	case removed == 0:
+		return self
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	}
+
+	return newBalancedNode(self.value, left, right)
+}
+
+/*
+Tree is one immutable version of a persistent range tree.  A Tree is safe
+to share between goroutines.
+*/
+type Tree struct {
+	root          *node
+	dimension     int
+	maxDimensions int
+	numChildren   int
+}
+
+func (self *Tree) isLastDimension() bool {
+	return self.dimension >= self.maxDimensions
+}
+
+func (self *Tree) all(fn func(r.Entry) bool) bool {
+	if self.root == nil {
+		return true
+	}
+
+	return self.root.all(fn)
+}
+
+func (self *Tree) All() []r.Entry {
+	entries := make([]r.Entry, 0, self.numChildren)
+	self.all(func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+func (self *Tree) getRange(query r.Query, fn func(r.Entry) bool) bool {
+	if self.root == nil {
+		return true
+	}
+
+	return self.root.getRange(self, query, fn, false, false)
+}
+
+func (self *Tree) GetRange(query r.Query) []r.Entry {
+	entries := []r.Entry{}
+
+	self.getRange(query, func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+func (self *Tree) Range(query r.Query, fn func(r.Entry) bool) {
+	self.getRange(query, fn)
+}
+
+func (self *Tree) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.getRange(query, yield)
+	}
+}
+
+func (self *Tree) count(query r.Query) int {
+	if self.root == nil {
+		return 0
+	}
+
+	return self.root.count(self, query, false, false)
+}
+
+func (self *Tree) Count(query r.Query) int {
+	return self.count(query)
+}
+
+type valuer interface {
+	GetDimensionalValue(dimension int) int
+}
+
+/*
+returns the last dimension leaf at the given coordinates, nil if there is
+none
+*/
+func (self *Tree) find(point valuer) *node {
+	if self.root == nil {
+		return nil
+	}
+
+	n := self.root.find(point.GetDimensionalValue(self.dimension))
+	if n == nil || n.rt == nil {
+		return n
+	}
+
+	return n.rt.find(point)
+}
+
+func (self *Tree) Get(values ...int) []r.Entry {
+	if len(values) != self.maxDimensions {
+		return nil
+	}
+
+	n := self.find(r.Coordinates(values))
+	if n == nil {
+		return nil
+	}
+
+	return []r.Entry{n.entry}
+}
+
+func (self *Tree) Contains(entry r.Entry) bool {
+	if r.ValidateEntries(self.maxDimensions, entry) != nil {
+		return false
+	}
+
+	n := self.find(entry)
+	return n != nil && r.SameEntry(n.entry, entry)
+}
+
+func (self *Tree) Len() int {
+	return self.numChildren
+}
+
+/*
+returns a new version with entries, sorted from this dimension on,
+inserted
+*/
+func (self *Tree) insert(entries []r.Entry) *Tree {
+	groups := groupEntries(entries, self.dimension)
+	if len(groups) == 0 {
+		return self
+	}
+
+	cp := *self
+	if self.root == nil {
+		cp.root = newNode(self, groups)
+		cp.numChildren = cp.root.numEntries()
+		return &cp
+	}
+
+	var added int
+	cp.root, _, added = self.root.insert(self, groups)
+	cp.numChildren += added
+
+	return &cp
+}
+
+/*
+Returns a new version of the tree with the entries added.  Entries replace
+any entry already at the same coordinates.  The receiver is not modified,
+nor is the caller's slice.  Panics if an entry is invalid.
+*/
+func (self *Tree) Insert(entries ...r.Entry) *Tree {
+	tree, err := self.InsertChecked(entries...)
+	if err != nil {
+		panic(err)
+	}
+
+	return tree
+}
+
+/*
+Like Insert but returns an error, and the receiver, if an entry is nil or
+has the wrong number of dimensions.
+*/
+func (self *Tree) InsertChecked(entries ...r.Entry) (*Tree, error) {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return self, err
+	}
+
+	return self.insert(sortEntries(entries, self.maxDimensions)), nil
+}
+
+/*
+returns the receiver itself when nothing was removed
+*/
+func (self *Tree) remove(entry r.Entry) *Tree {
+	if self.root == nil {
+		return self
+	}
+
+	root, removed := self.root.remove(self, entry)
+	if !removed {
+		return self
+	}
+
+	cp := *self
+	cp.root = root
+	cp.numChildren--
+
+	return &cp
+}
+
+/*
+Returns a new version of the tree without the given entries, an other
+entry at the same coordinates is left in place.  The receiver is not
+modified.  Panics if an entry is invalid.
+*/
+func (self *Tree) Remove(entries ...r.Entry) *Tree {
+	tree, err := self.RemoveChecked(entries...)
+	if err != nil {
+		panic(err)
+	}
+
+	return tree
+}
+
+/*
+Like Remove but returns an error, and the receiver, if an entry is nil or
+has the wrong number of dimensions.
+*/
+func (self *Tree) RemoveChecked(entries ...r.Entry) (*Tree, error) {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return self, err
+	}
+
+	tree := self
+	for _, entry := range entries {
+		tree = tree.remove(entry)
+	}
+
+	return tree, nil
+}
+
+/*
+Returns a new version of the tree with old replaced by entry, and true, or
+the receiver and false if old isn't in the tree.  Panics if either entry
+is invalid.
+*/
+func (self *Tree) Update(old, entry r.Entry) (*Tree, bool) {
+	if err := r.ValidateEntries(self.maxDimensions, old, entry); err != nil {
+		panic(err)
+	}
+
+	tree := self.remove(old)
+	if tree == self {
+		return self, false
+	}
+
+	return tree.insert([]r.Entry{entry}), true
+}
+
+/*
+returns the receiver itself when nothing was removed
+*/
+func (self *Tree) removeRange(query r.Query) (*Tree, int) {
+	if self.root == nil {
+		return self, 0
+	}
+
+	root, removed := self.root.removeRange(self, query, false, false)
+	if removed == 0 {
+		return self, 0
+	}
+
+	cp := *self
+	cp.root = root
+	cp.numChildren -= removed
+
+	return &cp, removed
+}
+
+/*
+Returns a new version of the tree without the entries within the query,
+and the number of entries removed.  Subtrees covered by the query are
+dropped whole.
+*/
+func (self *Tree) RemoveRange(query r.Query) (*Tree, int) {
+	return self.removeRange(query)
+}
+
+/*
+Returns an empty version of the tree.
+*/
+func (self *Tree) Clear() *Tree {
+	return new(self.maxDimensions, self.dimension, nil)
+}
+
+func new(maxDimensions, dimension int, entries []r.Entry) *Tree {
+	t := &Tree{
+		maxDimensions: maxDimensions,
+		dimension:     dimension,
+	}
+
+	return t.insert(entries)
+}
+
+func New(maxDimensions int, entries ...r.Entry) *Tree {
+	return new(maxDimensions, 1, sortEntries(entries, maxDimensions))
+}
+
+/*
+handle adapts the immutable versions to the mutable rangetree.RangeTree
+interface by swapping in the new version after every write.
+*/
+type handle struct {
+	current *Tree
+}
+
+func (self *handle) Insert(entries ...r.Entry) {
+	self.current = self.current.Insert(entries...)
+}
+
+func (self *handle) Remove(entries ...r.Entry) {
+	self.current = self.current.Remove(entries...)
+}
+
+func (self *handle) InsertChecked(entries ...r.Entry) error {
+	tree, err := self.current.InsertChecked(entries...)
+	self.current = tree
+	return err
+}
+
+func (self *handle) RemoveChecked(entries ...r.Entry) error {
+	tree, err := self.current.RemoveChecked(entries...)
+	self.current = tree
+	return err
+}
+
+func (self *handle) Update(old, entry r.Entry) bool {
+	tree, found := self.current.Update(old, entry)
+	self.current = tree
+	return found
+}
+
+func (self *handle) RemoveRange(query r.Query) int {
+	tree, removed := self.current.RemoveRange(query)
+	self.current = tree
+	return removed
+}
+
+func (self *handle) Clear() {
+	self.current = self.current.Clear()
+}
+
+func (self *handle) GetRange(query r.Query) []r.Entry {
+	return self.current.GetRange(query)
+}
+
+func (self *handle) Range(query r.Query, fn func(r.Entry) bool) {
+	self.current.Range(query, fn)
+}
+
+func (self *handle) Iter(query r.Query) iter.Seq[r.Entry] {
+	return self.current.Iter(query)
+}
+
+func (self *handle) Count(query r.Query) int {
+	return self.current.Count(query)
+}
+
+func (self *handle) Get(values ...int) []r.Entry {
+	return self.current.Get(values...)
+}
+
+func (self *handle) Contains(entry r.Entry) bool {
+	return self.current.Contains(entry)
+}
+
+func (self *handle) Len() int {
+	return self.current.Len()
+}
+
+func (self *handle) All() []r.Entry {
+	return self.current.All()
+}
+
+/*
+Copies in constant time, the copy shares the current version.
+*/
+func (self *handle) Copy() r.RangeTree {
+	return &handle{current: self.current}
+}
+
+/*
+Returns the version the handle currently points at.
+*/
+func (self *handle) Version() *Tree {
+	return self.current
+}
+
+/*
+Returns a rangetree.RangeTree that starts at the given version.  Writes
+through it produce new versions and leave version itself untouched.
+*/
+func Wrap(version *Tree) r.RangeTree {
+	return &handle{current: version}
+}
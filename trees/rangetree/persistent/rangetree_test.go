@@ -0,0 +1,449 @@
+package persistent
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/rangetreetest"
+)
+
+type point struct {
+	coordinates [2]int
+}
+
+func (self *point) GetDimensionalValue(dimension int) int {
+	return self.coordinates[dimension-1]
+}
+
+func (self *point) MaxDimensions() int {
+	return len(self.coordinates)
+}
+
+func (self *point) Less(other r.Entry, dimension int) bool {
+	return compareEntries(self, other, 1, dimension) < 0
+}
+
+func newPoint(x, y int) *point {
+	return &point{[2]int{x, y}}
+}
+
+type bound struct {
+	low, high int
+}
+
+func (self bound) Low() int {
+	return self.low
+}
+
+func (self bound) High() int {
+	return self.high
+}
+
+type query [2]bound
+
+func (self query) GetDimensionalBounds(dimension int) r.Bounds {
+	return self[dimension-1]
+}
+
+func newQuery(startRow, stopRow, startColumn, stopColumn int) query {
+	return query{bound{startRow, stopRow}, bound{startColumn, stopColumn}}
+}
+
+func checkPoints(t *testing.T, entries []r.Entry, expected ...[2]int) {
+	if len(entries) != len(expected) {
+		t.Errorf(`Expected len: %d, received: %d`, len(expected), len(entries))
+		return
+	}
+
+	for _, coordinates := range expected {
+		found := false
+		for _, entry := range entries {
+			if entry.(*point).coordinates == coordinates {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf(`Expected: %+v, not found.`, coordinates)
+		}
+	}
+}
+
+func checkTreeCounts(t *testing.T, tree *Tree) {
+	var walk func(n *node) int
+	walk = func(n *node) int {
+		if n.isLeaf() {
+			if n.rt != nil {
+				checkTreeCounts(t, n.rt)
+			}
+			return 1
+		}
+
+		leaves := walk(n.left) + walk(n.right)
+		if n.numChildren != leaves {
+			t.Errorf(`Expected num children: %d, received: %d`, leaves, n.numChildren)
+		}
+		return leaves
+	}
+
+	if tree.root != nil {
+		walk(tree.root)
+	}
+
+	if entries := len(tree.All()); entries != tree.numChildren {
+		t.Errorf(`Expected len: %d, received: %d`, entries, tree.numChildren)
+	}
+}
+
+func TestInsertReturnsNewVersion(t *testing.T) {
+	v0 := New(2)
+	v1 := v0.Insert(newPoint(0, 0), newPoint(1, 1))
+	v2 := v1.Insert(newPoint(2, 2))
+
+	if v0.Len() != 0 || v1.Len() != 2 || v2.Len() != 3 {
+		t.Errorf(`Expected lens 0, 2, 3, received: %d, %d, %d`, v0.Len(), v1.Len(), v2.Len())
+	}
+
+	q := newQuery(0, 10, 0, 10)
+	checkPoints(t, v0.GetRange(q))
+	checkPoints(t, v1.GetRange(q), [2]int{0, 0}, [2]int{1, 1})
+	checkPoints(t, v2.GetRange(q), [2]int{0, 0}, [2]int{1, 1}, [2]int{2, 2})
+}
+
+func TestRemoveReturnsNewVersion(t *testing.T) {
+	a, b, c := newPoint(0, 0), newPoint(0, 1), newPoint(1, 1)
+	v1 := New(2, a, b, c)
+	v2 := v1.Remove(b)
+	v3 := v2.Remove(a, c)
+
+	q := newQuery(0, 10, 0, 10)
+	checkPoints(t, v1.GetRange(q), [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1})
+	checkPoints(t, v2.GetRange(q), [2]int{0, 0}, [2]int{1, 1})
+	checkPoints(t, v3.GetRange(q))
+
+	if v3.root != nil || v3.Len() != 0 {
+		t.Errorf(`Expected empty tree, received: %+v`, v3)
+	}
+
+	if v4 := v3.Remove(newPoint(5, 5)); v4 != v3 {
+		t.Errorf(`Expected the same version when nothing is removed.`)
+	}
+
+	if v4 := v2.Remove(newPoint(0, 0)); v4 != v2 {
+		t.Errorf(`Expected an other entry at the same coordinates to remove nothing.`)
+	}
+}
+
+func TestUnchangedSubtreesAreShared(t *testing.T) {
+	origin := newPoint(0, 0)
+	v1 := New(2, origin, newPoint(1, 1), newPoint(2, 2), newPoint(3, 3))
+	v2 := v1.Insert(newPoint(3, 4))
+
+	if v1.root == v2.root {
+		t.Fatalf(`Expected a new root.`)
+	}
+
+	if v1.root.left != v2.root.left {
+		t.Errorf(`Expected the untouched left subtree to be shared.`)
+	}
+
+	if v1.root.right.left != v2.root.right.left {
+		t.Errorf(`Expected the untouched leaf to be shared.`)
+	}
+
+	v3 := v2.Remove(origin)
+	if v2.root.right != v3.root.right {
+		t.Errorf(`Expected the untouched right subtree to be shared.`)
+	}
+}
+
+func depth(n *node) int {
+	if n == nil || n.isLeaf() {
+		return 0
+	}
+
+	return 1 + max(depth(n.left), depth(n.right))
+}
+
+func checkBalanced(t *testing.T, tree *Tree) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n.isLeaf() {
+			if n.rt != nil {
+				checkBalanced(t, n.rt)
+			}
+			return
+		}
+
+		total := float64(n.size())
+		if float64(n.left.size())/total < balance || float64(n.right.size())/total < balance {
+			t.Errorf(`Unbalanced node %d, left: %d, right: %d`, n.value, n.left.size(), n.right.size())
+		}
+
+		walk(n.left)
+		walk(n.right)
+	}
+
+	if tree.root != nil {
+		walk(tree.root)
+	}
+}
+
+func TestSequentialInsertsStayBalanced(t *testing.T) {
+	tree := New(2)
+	versions := make([]*Tree, 0)
+	points := make([]*point, 1024)
+
+	for i := range points {
+		points[i] = newPoint(i, 0)
+		tree = tree.Insert(points[i])
+		if i%256 == 0 {
+			versions = append(versions, tree)
+		}
+	}
+
+	for i := 0; i < 1024; i++ { // a single row in the second dimension
+		tree = tree.Insert(newPoint(2000, i))
+	}
+
+	checkBalanced(t, tree)
+	checkTreeCounts(t, tree)
+
+	if d := depth(tree.root); d > 20 {
+		t.Errorf(`Expected logarithmic depth, received: %d`, d)
+	}
+
+	if d := depth(tree.root.find(2000).rt.root); d > 20 {
+		t.Errorf(`Expected logarithmic depth in the second dimension, received: %d`, d)
+	}
+
+	for i, version := range versions {
+		if version.Len() != 256*i+1 {
+			t.Errorf(`Expected len: %d, received: %d`, 256*i+1, version.Len())
+		}
+		checkTreeCounts(t, version)
+	}
+
+	for i := 0; i < 1000; i++ { // remove from the left edge only
+		tree = tree.Remove(points[i])
+	}
+
+	checkBalanced(t, tree)
+	if tree.Len() != 1048 {
+		t.Errorf(`Expected len: %d, received: %d`, 1048, tree.Len())
+	}
+	checkTreeCounts(t, tree)
+}
+
+func TestInsertReplacesDuplicates(t *testing.T) {
+	first, second := newPoint(0, 0), newPoint(0, 0)
+
+	v1 := New(2, first)
+	v2 := v1.Insert(second)
+
+	if v2.Len() != 1 {
+		t.Errorf(`Expected len: %d, received: %d`, 1, v2.Len())
+	}
+
+	if entry := v2.All()[0]; entry != second {
+		t.Errorf(`Expected entry: %+v, received: %+v`, second, entry)
+	}
+
+	if entry := v1.All()[0]; entry != first {
+		t.Errorf(`Expected entry: %+v, received: %+v`, first, entry)
+	}
+}
+
+func TestWrapCopyIsConstantAndIndependent(t *testing.T) {
+	origin := newPoint(0, 0)
+	tree := Wrap(New(2, origin))
+	cp := tree.Copy()
+
+	if cp.(*handle).Version() != tree.(*handle).Version() {
+		t.Errorf(`Expected the copy to share the version.`)
+	}
+
+	tree.Insert(newPoint(1, 1))
+	cp.Remove(origin)
+
+	checkPoints(t, tree.All(), [2]int{0, 0}, [2]int{1, 1})
+	checkPoints(t, cp.All())
+
+	tree.Clear()
+	if tree.Len() != 0 || tree.Count(newQuery(0, 10, 0, 10)) != 0 {
+		t.Errorf(`Expected empty tree after clear.`)
+	}
+}
+
+func TestOldVersionsMatchBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	max := 15
+
+	versions := []*Tree{New(2)}
+	states := []map[[2]int]bool{{}}
+
+	for i := 0; i < 300; i++ {
+		tree := versions[len(versions)-1]
+		state := make(map[[2]int]bool)
+		for k := range states[len(states)-1] {
+			state[k] = true
+		}
+
+		p := newPoint(rnd.Intn(max), rnd.Intn(max))
+		if rnd.Intn(3) == 0 {
+			tree = tree.Remove(tree.Get(p.coordinates[:]...)...)
+			delete(state, p.coordinates)
+		} else {
+			tree = tree.Insert(p)
+			state[p.coordinates] = true
+		}
+
+		versions = append(versions, tree)
+		states = append(states, state)
+	}
+
+	for i, tree := range versions {
+		checkTreeCounts(t, tree)
+
+		x, y := rnd.Intn(max), rnd.Intn(max)
+		q := newQuery(x, x+rnd.Intn(max), y, y+rnd.Intn(max))
+
+		expected := make([][2]int, 0)
+		for coordinates := range states[i] {
+			if coordinates[0] >= q[0].low && coordinates[0] < q[0].high &&
+				coordinates[1] >= q[1].low && coordinates[1] < q[1].high {
+				expected = append(expected, coordinates)
+			}
+		}
+
+		checkPoints(t, tree.GetRange(q), expected...)
+		if count := tree.Count(q); count != len(expected) {
+			t.Errorf(`Expected count: %d, received: %d`, len(expected), count)
+		}
+	}
+}
+
+func TestGetAndContains(t *testing.T) {
+	p := newPoint(1, 1)
+	v1 := New(2, newPoint(0, 0), p)
+	v2 := v1.Remove(p)
+
+	if entries := v1.Get(1, 1); len(entries) != 1 || entries[0] != p {
+		t.Errorf(`Expected entry: %+v, received: %+v`, p, entries)
+	}
+
+	if entries := v2.Get(1, 1); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+
+	if !v1.Contains(p) || v2.Contains(p) || v1.Contains(newPoint(1, 1)) {
+		t.Errorf(`Expected only the old version to contain (1, 1).`)
+	}
+
+	if Wrap(v2).Contains(nil) {
+		t.Errorf(`Expected tree not to contain nil.`)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	p, moved := newPoint(1, 1), newPoint(1, 4)
+	v1 := New(2, newPoint(0, 0), p)
+
+	v2, found := v1.Update(p, moved)
+	if !found {
+		t.Fatalf(`Expected to find: %+v`, p)
+	}
+
+	checkPoints(t, v1.All(), [2]int{0, 0}, [2]int{1, 1})
+	checkPoints(t, v2.All(), [2]int{0, 0}, [2]int{1, 4})
+	checkTreeCounts(t, v2)
+
+	if v3, found := v2.Update(p, newPoint(2, 2)); found || v3 != v2 {
+		t.Errorf(`Expected the same version when nothing is found.`)
+	}
+
+	if !Wrap(v2).Update(moved, newPoint(0, 0)) {
+		t.Errorf(`Expected the handle to find: %+v`, moved)
+	}
+}
+
+func TestRemoveRange(t *testing.T) {
+	v1 := New(2, newPoint(0, 0), newPoint(0, 1), newPoint(1, 1), newPoint(2, 3), newPoint(3, 1))
+
+	v2, removed := v1.RemoveRange(newQuery(0, 3, 1, 2))
+	if removed != 2 {
+		t.Errorf(`Expected removed: %d, received: %d`, 2, removed)
+	}
+
+	checkPoints(t, v1.All(), [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 3}, [2]int{3, 1})
+	checkPoints(t, v2.All(), [2]int{0, 0}, [2]int{2, 3}, [2]int{3, 1})
+	checkTreeCounts(t, v2)
+
+	if v3, removed := v2.RemoveRange(newQuery(5, 10, 0, 10)); removed != 0 || v3 != v2 {
+		t.Errorf(`Expected the same version when nothing is removed.`)
+	}
+
+	handle := Wrap(v2)
+	if removed := handle.RemoveRange(newQuery(0, 10, 0, 10)); removed != 3 || handle.Len() != 0 {
+		t.Errorf(`Expected an empty tree, removed: %d`, removed)
+	}
+}
+
+func TestRemoveRangeMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	max := 20
+
+	for i := 0; i < 20; i++ {
+		tree := New(2)
+		state := make(map[[2]int]bool)
+		for j := 0; j < 150; j++ {
+			p := newPoint(rnd.Intn(max), rnd.Intn(max))
+			tree = tree.Insert(p)
+			state[p.coordinates] = true
+		}
+
+		x, y := rnd.Intn(max), rnd.Intn(max)
+		q := newQuery(x, x+rnd.Intn(max), y, y+rnd.Intn(max))
+
+		expected := make([][2]int, 0)
+		for coordinates := range state {
+			if coordinates[0] < q[0].low || coordinates[0] >= q[0].high ||
+				coordinates[1] < q[1].low || coordinates[1] >= q[1].high {
+				expected = append(expected, coordinates)
+			}
+		}
+
+		pruned, removed := tree.RemoveRange(q)
+		if removed != len(state)-len(expected) {
+			t.Errorf(`Expected removed: %d, received: %d`, len(state)-len(expected), removed)
+		}
+
+		checkTreeCounts(t, pruned)
+		checkPoints(t, pruned.All(), expected...)
+		if tree.Len() != len(state) {
+			t.Errorf(`Expected the old version to keep len: %d, received: %d`, len(state), tree.Len())
+		}
+	}
+}
+
+func TestQueryBounds(t *testing.T) {
+	tree := New(2, newPoint(0, 0), newPoint(1, math.MaxInt), newPoint(2, 5))
+
+	checkPoints(t, tree.GetRange(r.NewQuery(nil, r.AtLeast(5))), [2]int{1, math.MaxInt}, [2]int{2, 5})
+	if count := tree.Count(r.NewQuery(r.Closed(0, 1))); count != 2 {
+		t.Errorf(`Expected count: %d, received: %d`, 2, count)
+	}
+
+	pruned, removed := tree.RemoveRange(r.NewQuery(r.Above(0)))
+	if removed != 2 || pruned.Len() != 1 {
+		t.Errorf(`Expected removed: %d, received: %d`, 2, removed)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	rangetreetest.RunConformance(t, func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+		return Wrap(New(maxDimensions, entries...))
+	})
+}
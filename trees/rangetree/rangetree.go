@@ -1,5 +1,7 @@
 package rangetree
 
+import "iter"
+
 type Entry interface {
 	/*
 		Pass in an int representing the dimension of interest and returns
@@ -17,9 +19,43 @@ type Entry interface {
 	Less(entry Entry, dimension int) bool
 }
 
+/*
+Coordinates is an Entry made of nothing but its values, dimension 1
+first.  It stands in for an entry where only a point is needed, to find
+the entries at given coordinates for instance.
+*/
+type Coordinates []int
+
+func (self Coordinates) GetDimensionalValue(dimension int) int {
+	return self[dimension-1]
+}
+
+func (self Coordinates) MaxDimensions() int {
+	return len(self)
+}
+
+func (self Coordinates) Less(entry Entry, dimension int) bool {
+	return Compare(self, entry, dimension) < 0
+}
+
+/*
+Shifter is implemented by entries whose coordinates can be moved, see the
+Shift method of the v1 tree.
+*/
+type Shifter interface {
+	Entry
+	/*
+		Returns the entry with its value in the given dimension moved by
+		delta.  The result may be a new entry or the receiver, modified.
+	*/
+	Shift(dimension, delta int) Entry
+}
+
 type Bounds interface {
 	/*
-		[Low, High) Houses the high/low values for a query
+		[Low, High) Houses the high/low values for a query.  Bounds that
+		include High, or are unbounded, also implement InclusiveBounds,
+		see Closed, AtLeast and the other constructors.
 	*/
 	High() int
 	Low() int
@@ -27,18 +63,83 @@ type Bounds interface {
 
 type Query interface {
 	/*
-		Returns a bounds interface for the given dimension.  Return
-		nil if the dimension is outside the bounds of the query
+		Returns a bounds interface for the given dimension.  Returning
+		nil matches every value in that dimension.
 	*/
 	GetDimensionalBounds(dimension int) Bounds
 }
 
+/*
+Reader is the query half of a RangeTree.  Trees that can't be changed,
+such as a static tree, implement only this.
+*/
+type Reader interface {
+	GetRange(query Query) []Entry
+	/*
+		Calls fn with every entry that falls within the query, in the
+		order of Compare, stopping as soon as fn returns false.  Nothing
+		proportional to the size of the tree is allocated.
+	*/
+	Range(query Query, fn func(Entry) bool)
+	/*
+		Returns an iterator over the entries that fall within the query.
+		This is the range-over-func form of Range.
+	*/
+	Iter(query Query) iter.Seq[Entry]
+	/*
+		Returns the number of entries that fall within the query without
+		materializing them.
+	*/
+	Count(query Query) int
+	/*
+		Returns the entries at exactly the given coordinates, one value
+		per dimension starting with dimension 1.  Returns nil if there are
+		none or the number of coordinates doesn't match the tree.
+	*/
+	Get(coordinates ...int) []Entry
+	/*
+		Returns true if the tree holds the given entry, see SameEntry.  An
+		other entry at the same coordinates doesn't count, use Get to look
+		up coordinates.
+	*/
+	Contains(entry Entry) bool
+	Len() int
+	All() []Entry
+}
+
 type RangeTree interface {
+	Reader
+	/*
+		Removes the entries, each only if the tree holds that very entry,
+		see SameEntry.  Panics if one is nil or has the wrong number of
+		dimensions.
+	*/
 	Remove(entries ...Entry)
-	GetRange(query Query) []Entry
+	/*
+		Validates the entries before removing any of them, returning an
+		error wrapping one of the Err values in this package.
+	*/
+	RemoveChecked(entries ...Entry) error
+	/*
+		Inserts the entries, panics if any of them is invalid.
+	*/
 	Insert(entries ...Entry)
+	/*
+		Validates the entries before inserting any of them, returning an
+		error wrapping one of the Err values in this package.
+	*/
+	InsertChecked(entries ...Entry) error
+	/*
+		Replaces old with entry, which may have different coordinates.
+		Returns false, leaving the tree unchanged, if old isn't in the
+		tree.  Panics if either entry is invalid.
+	*/
+	Update(old, entry Entry) bool
+	/*
+		Removes every entry within the query and returns how many were
+		removed.
+	*/
+	RemoveRange(query Query) int
 	Copy() RangeTree
 	Clear()
-	Len() int
-	All() []Entry
 }
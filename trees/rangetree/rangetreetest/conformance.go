@@ -0,0 +1,433 @@
+/*
+Package rangetreetest checks that an implementation of rangetree.RangeTree
+behaves like every other one.  RunConformance drives a tree through each
+method of the interface and compares what it sees against a Reference,
+a brute-force tree over a plain slice of entries.  RunConformanceWithModes
+does the same in each duplicate mode.
+*/
+package rangetreetest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+Factory returns a new tree of the given dimensions holding the entries,
+with the default duplicate mode, Replace.
+*/
+type Factory func(maxDimensions int, entries ...r.Entry) r.RangeTree
+
+/*
+ModeFactory returns a new tree of the given dimensions and duplicate mode
+holding the entries.
+*/
+type ModeFactory func(maxDimensions int, mode r.DuplicateMode, entries ...r.Entry) r.RangeTree
+
+/*
+the trees under test along with the duplicate mode they were built with
+*/
+type suite struct {
+	factory Factory
+	mode    r.DuplicateMode
+}
+
+/*
+returns a Reference in the suite's duplicate mode holding the entries
+*/
+func (self suite) reference(maxDimensions int, entries ...r.Entry) r.RangeTree {
+	return NewReferenceWithMode(maxDimensions, self.mode, entries...)
+}
+
+type point struct {
+	coordinates []int
+	id          int64
+}
+
+func (self *point) GetDimensionalValue(dimension int) int {
+	return self.coordinates[dimension-1]
+}
+
+func (self *point) MaxDimensions() int {
+	return len(self.coordinates)
+}
+
+func (self *point) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+func (self *point) String() string {
+	return fmt.Sprintf(`%v#%d`, self.coordinates, self.id)
+}
+
+// atomic so suites may run in parallel
+var ids atomic.Int64
+
+func newPoint(coordinates ...int) *point {
+	return &point{coordinates, ids.Add(1)}
+}
+
+/*
+[low, high) without InclusiveBounds, as older callers pass
+*/
+type halfOpen struct {
+	low, high int
+}
+
+func (self halfOpen) Low() int {
+	return self.low
+}
+
+func (self halfOpen) High() int {
+	return self.high
+}
+
+func checkEntries(t *testing.T, name string, expected, received []r.Entry) {
+	t.Helper()
+	if len(expected) != len(received) {
+		t.Fatalf(`%s: expected %d entries: %v, received %d: %v`,
+			name, len(expected), expected, len(received), received)
+	}
+
+	for i := range expected {
+		if expected[i] != received[i] {
+			t.Fatalf(`%s: expected %v at %d, received: %v`, name, expected[i], i, received[i])
+		}
+	}
+}
+
+/*
+compares everything the tree answers about the query with the reference
+*/
+func checkQuery(t *testing.T, tree r.RangeTree, expected r.RangeTree, query r.Query) {
+	t.Helper()
+	entries := expected.GetRange(query)
+	checkEntries(t, `GetRange`, entries, tree.GetRange(query))
+
+	if count := tree.Count(query); count != len(entries) {
+		t.Fatalf(`Count: expected %d, received: %d`, len(entries), count)
+	}
+
+	ranged := make([]r.Entry, 0)
+	tree.Range(query, func(entry r.Entry) bool {
+		ranged = append(ranged, entry)
+		return true
+	})
+	checkEntries(t, `Range`, entries, ranged)
+
+	iterated := make([]r.Entry, 0)
+	for entry := range tree.Iter(query) {
+		iterated = append(iterated, entry)
+	}
+	checkEntries(t, `Iter`, entries, iterated)
+}
+
+func checkTree(t *testing.T, tree r.RangeTree, expected r.RangeTree) {
+	t.Helper()
+	if tree.Len() != expected.Len() {
+		t.Fatalf(`Len: expected %d, received: %d`, expected.Len(), tree.Len())
+	}
+
+	checkEntries(t, `All`, expected.All(), tree.All())
+
+	for _, entry := range expected.All() {
+		if !tree.Contains(entry) {
+			t.Fatalf(`Contains: expected %v`, entry)
+		}
+
+		coordinates := entry.(*point).coordinates
+		checkEntries(t, `Get`, expected.Get(coordinates...), tree.Get(coordinates...))
+	}
+}
+
+func randomQuery(rnd *rand.Rand, dimensions, max int) r.Query {
+	bounds := make([]r.Bounds, dimensions)
+	for i := range bounds {
+		low := rnd.Intn(max+2) - 1
+		switch rnd.Intn(6) {
+		case 0:
+			continue // every value
+		case 1:
+			bounds[i] = halfOpen{low, low + rnd.Intn(max)}
+		case 2:
+			bounds[i] = r.AtLeast(low)
+		case 3:
+			bounds[i] = r.Open(low, low+rnd.Intn(max))
+		default:
+			bounds[i] = r.Closed(low, low+rnd.Intn(max))
+		}
+	}
+
+	return r.NewQuery(bounds...)
+}
+
+func randomPoint(rnd *rand.Rand, dimensions, max int) *point {
+	coordinates := make([]int, dimensions)
+	for i := range coordinates {
+		coordinates[i] = rnd.Intn(max)
+	}
+
+	return newPoint(coordinates...)
+}
+
+/*
+a random point, or most of the time the entry the reference holds at its
+coordinates if there is one, so removals find something
+*/
+func randomEntry(rnd *rand.Rand, expected r.RangeTree, dimensions, max int) r.Entry {
+	p := randomPoint(rnd, dimensions, max)
+	if entries := expected.Get(p.coordinates...); len(entries) > 0 && rnd.Intn(4) != 0 {
+		return entries[rnd.Intn(len(entries))]
+	}
+
+	return p
+}
+
+func testEmpty(t *testing.T, s suite) {
+	tree := s.factory(2)
+	checkTree(t, tree, s.reference(2))
+	checkQuery(t, tree, s.reference(2), r.NewQuery())
+
+	if tree.Get(0, 0) != nil || tree.Contains(newPoint(0, 0)) {
+		t.Errorf(`Expected an empty tree to hold nothing.`)
+	}
+
+	if tree.Update(newPoint(0, 0), newPoint(1, 1)) || tree.RemoveRange(r.NewQuery()) != 0 {
+		t.Errorf(`Expected an empty tree to change nothing.`)
+	}
+
+	tree.Remove(newPoint(0, 0))
+	tree.Clear()
+	checkTree(t, tree, s.reference(2))
+}
+
+func testDuplicates(t *testing.T, s suite) {
+	a, b, c, d := newPoint(1, 1), newPoint(1, 1), newPoint(2, 2), newPoint(2, 2)
+	tree := s.factory(2, a, b, c)
+	expected := s.reference(2, a, b, c)
+	checkTree(t, tree, expected)
+
+	tree.Insert(d)
+	expected.Insert(d)
+	checkTree(t, tree, expected)
+
+	// the mode applies within a batch as well
+	e, f := newPoint(3, 3), newPoint(3, 3)
+	tree.Insert(e, f)
+	expected.Insert(e, f)
+	checkTree(t, tree, expected)
+
+	held := map[r.DuplicateMode][]r.Entry{r.Replace: {b}, r.Set: {a}, r.Multiset: {a, b}}[s.mode]
+	checkEntries(t, `Get`, held, tree.Get(1, 1))
+
+	if tree.Get(1, 2) != nil || tree.Get(1) != nil {
+		t.Errorf(`Expected Get to find only occupied coordinates.`)
+	}
+
+	for _, entry := range []r.Entry{a, b, newPoint(1, 1)} {
+		if received := tree.Contains(entry); received != expected.Contains(entry) {
+			t.Errorf(`Contains of %v: expected %t, received: %t`, entry, !received, received)
+		}
+	}
+
+	// an other entry at the same coordinates is left alone
+	tree.Remove(newPoint(1, 1))
+	checkTree(t, tree, expected)
+
+	tree.Remove(a)
+	expected.Remove(a)
+	checkTree(t, tree, expected)
+
+	tree.Remove(b)
+	expected.Remove(b)
+	checkTree(t, tree, expected)
+}
+
+func testInvalid(t *testing.T, s suite) {
+	a := newPoint(1, 1)
+	tree := s.factory(2, a)
+	expected := s.reference(2, a)
+
+	if err := tree.InsertChecked(newPoint(2, 2), nil); !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`InsertChecked: expected nil entry, received: %v`, err)
+	}
+
+	if err := tree.InsertChecked(newPoint(2, 2), newPoint(3)); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`InsertChecked: expected dimension mismatch, received: %v`, err)
+	}
+
+	if err := tree.RemoveChecked(a, nil); !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`RemoveChecked: expected nil entry, received: %v`, err)
+	}
+
+	if err := tree.RemoveChecked(a, newPoint(1, 1, 1)); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`RemoveChecked: expected dimension mismatch, received: %v`, err)
+	}
+	checkTree(t, tree, expected)
+
+	if tree.Contains(newPoint(1)) || tree.Contains(nil) {
+		t.Errorf(`Expected Contains to reject an invalid entry.`)
+	}
+
+	panics := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf(`%s: expected a panic on an invalid entry.`, name)
+			}
+		}()
+		fn()
+	}
+
+	panics(`Insert`, func() { tree.Insert(nil) })
+	panics(`Remove`, func() { tree.Remove(newPoint(1)) })
+	panics(`Update`, func() { tree.Update(a, nil) })
+	checkTree(t, tree, expected)
+}
+
+func testCopy(t *testing.T, s suite) {
+	rnd := rand.New(rand.NewSource(7))
+	tree := s.factory(2)
+	expected := s.reference(2)
+	for i := 0; i < 50; i++ {
+		p := randomPoint(rnd, 2, 10)
+		tree.Insert(p)
+		expected.Insert(p)
+	}
+
+	cp := tree.Copy()
+	copied := expected.Copy()
+
+	for i := 0; i < 20; i++ {
+		p := randomPoint(rnd, 2, 10)
+		tree.Insert(p)
+		expected.Insert(p)
+
+		q := randomEntry(rnd, copied, 2, 10)
+		cp.Remove(q)
+		copied.Remove(q)
+	}
+
+	checkTree(t, tree, expected)
+	checkTree(t, cp, copied)
+
+	cp.Clear()
+	checkTree(t, cp, s.reference(2))
+	checkTree(t, tree, expected)
+}
+
+func testStopsEarly(t *testing.T, s suite) {
+	a, b, c, d := newPoint(2, 1), newPoint(1, 2), newPoint(1, 1), newPoint(3, 0)
+	tree := s.factory(2, a, b, c, d)
+
+	visited := make([]r.Entry, 0)
+	tree.Range(r.NewQuery(), func(entry r.Entry) bool {
+		visited = append(visited, entry)
+		return len(visited) < 2
+	})
+	checkEntries(t, `Range`, []r.Entry{c, b}, visited)
+
+	visited = visited[:0]
+	for entry := range tree.Iter(r.NewQuery()) {
+		visited = append(visited, entry)
+		break
+	}
+	checkEntries(t, `Iter`, []r.Entry{c}, visited)
+}
+
+func testRandom(t *testing.T, s suite) {
+	for dimensions := 1; dimensions <= 3; dimensions++ {
+		rnd := rand.New(rand.NewSource(int64(dimensions)))
+		max := 12
+
+		initial := make([]r.Entry, 0, 40)
+		for i := 0; i < 40; i++ {
+			initial = append(initial, randomPoint(rnd, dimensions, max))
+		}
+
+		tree := s.factory(dimensions, initial...)
+		expected := s.reference(dimensions, initial...)
+		checkTree(t, tree, expected)
+
+		for i := 0; i < 400; i++ {
+			switch op := rnd.Intn(10); {
+			case op < 4:
+				batch := make([]r.Entry, rnd.Intn(4)+1)
+				for j := range batch {
+					batch[j] = randomPoint(rnd, dimensions, max)
+				}
+				tree.Insert(batch...)
+				expected.Insert(batch...)
+			case op < 6:
+				p := randomEntry(rnd, expected, dimensions, max)
+				tree.Remove(p)
+				expected.Remove(p)
+			case op < 8:
+				old, entry := randomPoint(rnd, dimensions, max), randomPoint(rnd, dimensions, max)
+				if all := expected.All(); len(all) > 0 && rnd.Intn(2) == 0 {
+					old = all[rnd.Intn(len(all))].(*point)
+				}
+
+				found := expected.Update(old, entry)
+
+				if received := tree.Update(old, entry); received != found {
+					t.Fatalf(`Update of %v: expected %t, received: %t`, old, found, received)
+				}
+			case op < 9:
+				query := randomQuery(rnd, dimensions, max/2)
+				if removed, expectedRemoved := tree.RemoveRange(query), expected.RemoveRange(query); removed != expectedRemoved {
+					t.Fatalf(`RemoveRange: expected %d, received: %d`, expectedRemoved, removed)
+				}
+			default:
+				checkTree(t, tree, expected)
+			}
+
+			checkQuery(t, tree, expected, randomQuery(rnd, dimensions, max))
+
+			p := randomPoint(rnd, dimensions, max)
+			if entries := expected.Get(p.coordinates...); entries != nil {
+				checkEntries(t, `Get`, entries, tree.Get(p.coordinates...))
+			} else if tree.Get(p.coordinates...) != nil || tree.Contains(p) {
+				t.Fatalf(`Expected nothing at %v`, p)
+			}
+		}
+
+		checkTree(t, tree, expected)
+	}
+}
+
+func run(t *testing.T, s suite) {
+	t.Run(`Empty`, func(t *testing.T) { testEmpty(t, s) })
+	t.Run(`Duplicates`, func(t *testing.T) { testDuplicates(t, s) })
+	t.Run(`Invalid`, func(t *testing.T) { testInvalid(t, s) })
+	t.Run(`Copy`, func(t *testing.T) { testCopy(t, s) })
+	t.Run(`StopsEarly`, func(t *testing.T) { testStopsEarly(t, s) })
+	t.Run(`Random`, func(t *testing.T) { testRandom(t, s) })
+}
+
+/*
+Runs the conformance suite against the trees built by factory, each part
+as a subtest.  Trees are expected to keep the default duplicate mode,
+where an entry replaces any other at the same coordinates.
+*/
+func RunConformance(t *testing.T, factory Factory) {
+	run(t, suite{factory, r.Replace})
+}
+
+/*
+Runs the conformance suite once for each duplicate mode, as a subtest
+named for the mode, against the trees factory builds in that mode.
+*/
+func RunConformanceWithModes(t *testing.T, factory ModeFactory) {
+	for _, mode := range []r.DuplicateMode{r.Replace, r.Set, r.Multiset} {
+		t.Run(mode.String(), func(t *testing.T) {
+			run(t, suite{func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+				return factory(maxDimensions, mode, entries...)
+			}, mode})
+		})
+	}
+}
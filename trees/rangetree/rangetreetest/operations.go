@@ -0,0 +1,181 @@
+package rangetreetest
+
+import (
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+the operations a byte stream decodes into, by the first byte of each
+*/
+const (
+	opInsert = iota
+	opRemove
+	opGetRange
+	opCopy
+	opClear
+	opRemoveRange
+	numOps
+)
+
+/*
+reads a byte stream, running out quietly at its end
+*/
+type decoder struct {
+	data []byte
+}
+
+func (self *decoder) next() (byte, bool) {
+	if len(self.data) == 0 {
+		return 0, false
+	}
+
+	b := self.data[0]
+	self.data = self.data[1:]
+	return b, true
+}
+
+/*
+a coordinate from a small range, so entries collide often
+*/
+func (self *decoder) coordinate() (int, bool) {
+	b, ok := self.next()
+	return int(b%16) - 8, ok
+}
+
+func (self *decoder) point(dimensions int) (*point, bool) {
+	coordinates := make([]int, dimensions)
+	for i := range coordinates {
+		var ok bool
+		if coordinates[i], ok = self.coordinate(); !ok {
+			return nil, false
+		}
+	}
+
+	return newPoint(coordinates...), true
+}
+
+/*
+two bytes per dimension, a low value and a width whose top bits pick the
+kind of bounds
+*/
+func (self *decoder) query(dimensions int) (r.Query, bool) {
+	bounds := make([]r.Bounds, dimensions)
+	for i := range bounds {
+		low, ok := self.coordinate()
+		width, more := self.next()
+		if !ok || !more {
+			return nil, false
+		}
+
+		high := low + int(width%8)
+		switch width / 8 % 5 {
+		case 0:
+			continue // every value
+		case 1:
+			bounds[i] = halfOpen{low, high}
+		case 2:
+			bounds[i] = r.AtLeast(low)
+		case 3:
+			bounds[i] = r.Open(low, high)
+		default:
+			bounds[i] = r.Closed(low, high)
+		}
+	}
+
+	return r.NewQuery(bounds...), true
+}
+
+/*
+a tree alongside the reference it must match
+*/
+type pair struct {
+	tree, reference r.RangeTree
+}
+
+/*
+Decodes data into a sequence of operations on a tree from factory and on
+a Reference, failing t as soon as the two disagree.  The first byte picks
+between 1 and 4 dimensions, each operation after it is a byte choosing
+Insert, Remove, GetRange, Copy, Clear or RemoveRange followed by its
+arguments.  Copies are kept aside and checked again at the end, to catch
+changes leaking between a tree and its copy.  Any data is valid, which
+makes this the body of a fuzz target.
+*/
+func RunOperations(t *testing.T, factory Factory, data []byte) {
+	d := &decoder{data}
+	b, ok := d.next()
+	if !ok {
+		return
+	}
+	dimensions := int(b%4) + 1
+
+	current := pair{factory(dimensions), NewReference(dimensions)}
+	copies := make([]pair, 0)
+
+	for {
+		op, ok := d.next()
+		if !ok {
+			break
+		}
+
+		switch op % numOps {
+		case opInsert:
+			count, ok := d.next()
+			if !ok {
+				break
+			}
+
+			batch := make([]r.Entry, 0, count%4+1)
+			for len(batch) < cap(batch) {
+				p, ok := d.point(dimensions)
+				if !ok {
+					break
+				}
+				batch = append(batch, p)
+			}
+
+			current.tree.Insert(batch...)
+			current.reference.Insert(batch...)
+		case opRemove:
+			// usually the entry held at the point, else the point itself
+			// which removes nothing
+			if p, ok := d.point(dimensions); ok {
+				var entry r.Entry = p
+				if held := current.reference.Get(p.coordinates...); len(held) > 0 && op/numOps%2 == 0 {
+					entry = held[0]
+				}
+
+				current.tree.Remove(entry)
+				current.reference.Remove(entry)
+			}
+		case opGetRange:
+			if query, ok := d.query(dimensions); ok {
+				checkQuery(t, current.tree, current.reference, query)
+			}
+		case opCopy:
+			copies = append(copies, current)
+			current = pair{current.tree.Copy(), current.reference.Copy()}
+		case opClear:
+			current.tree.Clear()
+			current.reference.Clear()
+		case opRemoveRange:
+			if query, ok := d.query(dimensions); ok {
+				removed, expected := current.tree.RemoveRange(query), current.reference.RemoveRange(query)
+				if removed != expected {
+					t.Fatalf(`RemoveRange: expected %d, received: %d`, expected, removed)
+				}
+			}
+		}
+
+		if current.tree.Len() != current.reference.Len() {
+			t.Fatalf(`Len: expected %d, received: %d`, current.reference.Len(), current.tree.Len())
+		}
+	}
+
+	checkTree(t, current.tree, current.reference)
+	for _, cp := range copies {
+		checkTree(t, cp.tree, cp.reference)
+	}
+}
@@ -0,0 +1,244 @@
+package rangetreetest
+
+import (
+	"iter"
+	"slices"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+Reference is a naive RangeTree, a slice of entries kept in the order of
+Compare that every query scans.  It is too slow for anything but tests,
+where it is simple enough to trust as the expected result.  Entries at the
+same coordinates follow its duplicate mode, those a multiset keeps stay in
+the order they were inserted.  Remove and Contains match the exact entry
+given, see rangetree.SameEntry.
+*/
+type Reference struct {
+	maxDimensions int
+	mode          r.DuplicateMode
+	entries       []r.Entry
+}
+
+func (self *Reference) compare(a, b r.Entry) int {
+	return r.Compare(a, b, self.maxDimensions)
+}
+
+func (self *Reference) within(entry r.Entry, query r.Query) bool {
+	for dimension := 1; dimension <= self.maxDimensions; dimension++ {
+		low, high := r.Inclusive(query.GetDimensionalBounds(dimension))
+		if value := entry.GetDimensionalValue(dimension); value < low || value > high {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+the positions [start, end) of the entries at the coordinates of entry
+*/
+func (self *Reference) run(entry r.Entry) (int, int) {
+	start, _ := slices.BinarySearchFunc(self.entries, entry, self.compare)
+	end := start
+	for end < len(self.entries) && self.compare(self.entries[end], entry) == 0 {
+		end++
+	}
+
+	return start, end
+}
+
+/*
+the position of the entry itself, -1 if it isn't held
+*/
+func (self *Reference) index(entry r.Entry) int {
+	start, end := self.run(entry)
+	i := slices.IndexFunc(self.entries[start:end], func(e r.Entry) bool {
+		return r.SameEntry(e, entry)
+	})
+	if i < 0 {
+		return -1
+	}
+
+	return start + i
+}
+
+func (self *Reference) insert(entry r.Entry) {
+	start, end := self.run(entry)
+	switch {
+	case start == end || self.mode == r.Multiset:
+		self.entries = slices.Insert(self.entries, end, entry)
+	case self.mode == r.Replace:
+		self.entries[start] = entry
+	}
+}
+
+func (self *Reference) remove(entry r.Entry) bool {
+	i := self.index(entry)
+	if i < 0 {
+		return false
+	}
+
+	self.entries = slices.Delete(self.entries, i, i+1)
+	return true
+}
+
+func (self *Reference) Insert(entries ...r.Entry) {
+	if err := self.InsertChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *Reference) InsertChecked(entries ...r.Entry) error {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		self.insert(entry)
+	}
+
+	return nil
+}
+
+func (self *Reference) Remove(entries ...r.Entry) {
+	if err := self.RemoveChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *Reference) RemoveChecked(entries ...r.Entry) error {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		self.remove(entry)
+	}
+
+	return nil
+}
+
+func (self *Reference) Update(old, entry r.Entry) bool {
+	if err := r.ValidateEntries(self.maxDimensions, old, entry); err != nil {
+		panic(err)
+	}
+
+	if !self.remove(old) {
+		return false
+	}
+
+	self.insert(entry)
+	return true
+}
+
+func (self *Reference) RemoveRange(query r.Query) int {
+	before := len(self.entries)
+	self.entries = slices.DeleteFunc(self.entries, func(entry r.Entry) bool {
+		return self.within(entry, query)
+	})
+
+	return before - len(self.entries)
+}
+
+func (self *Reference) GetRange(query r.Query) []r.Entry {
+	entries := []r.Entry{}
+	self.Range(query, func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+func (self *Reference) Range(query r.Query, fn func(r.Entry) bool) {
+	for _, entry := range self.entries {
+		if self.within(entry, query) && !fn(entry) {
+			return
+		}
+	}
+}
+
+func (self *Reference) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.Range(query, yield)
+	}
+}
+
+func (self *Reference) Count(query r.Query) int {
+	count := 0
+	self.Range(query, func(r.Entry) bool {
+		count++
+		return true
+	})
+
+	return count
+}
+
+func (self *Reference) Get(values ...int) []r.Entry {
+	if len(values) != self.maxDimensions {
+		return nil
+	}
+
+	var entries []r.Entry
+	for _, entry := range self.entries {
+		if sameCoordinates(entry, values) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+func (self *Reference) Contains(entry r.Entry) bool {
+	if r.ValidateEntries(self.maxDimensions, entry) != nil {
+		return false
+	}
+
+	return self.index(entry) >= 0
+}
+
+func (self *Reference) Copy() r.RangeTree {
+	return &Reference{maxDimensions: self.maxDimensions, mode: self.mode, entries: slices.Clone(self.entries)}
+}
+
+func (self *Reference) Clear() {
+	self.entries = nil
+}
+
+func (self *Reference) Len() int {
+	return len(self.entries)
+}
+
+func (self *Reference) All() []r.Entry {
+	return slices.Clone(self.entries)
+}
+
+func sameCoordinates(entry r.Entry, values []int) bool {
+	for i, value := range values {
+		if entry.GetDimensionalValue(i+1) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+Returns a Reference holding the entries, panics if any of them is
+invalid.  It has the signature of a Factory.
+*/
+func NewReference(maxDimensions int, entries ...r.Entry) r.RangeTree {
+	return NewReferenceWithMode(maxDimensions, r.Replace, entries...)
+}
+
+/*
+Returns a Reference in the given duplicate mode holding the entries,
+panics if any of them is invalid.  It has the signature of a ModeFactory.
+*/
+func NewReferenceWithMode(maxDimensions int, mode r.DuplicateMode, entries ...r.Entry) r.RangeTree {
+	reference := &Reference{maxDimensions: maxDimensions, mode: mode}
+	reference.Insert(entries...)
+	return reference
+}
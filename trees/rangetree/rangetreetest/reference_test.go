@@ -0,0 +1,15 @@
+package rangetreetest
+
+import "testing"
+
+func TestReferenceConformance(t *testing.T) {
+	RunConformance(t, NewReference)
+}
+
+func TestReferenceConformanceWithModes(t *testing.T) {
+	RunConformanceWithModes(t, NewReferenceWithMode)
+}
+
+func TestOperationsOnReference(t *testing.T) {
+	RunOperations(t, NewReference, []byte{1, 0, 3, 9, 9, 10, 8, 8, 8, 3, 1, 9, 9, 2, 8, 40, 8, 40, 5, 8, 0, 8, 40, 4})
+}
@@ -0,0 +1,314 @@
+package static
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+/*
+the inclusive bounds of a query in each dimension, index 0 is dimension 1
+*/
+type box struct {
+	low, high []int
+}
+
+/*
+structure answers queries from one dimension on over a subset of the
+entries, which it knows by their rank in the order of Compare.  Its
+positions hold those entries ordered from its dimension on, ordered
+visits them in that order, which for the structure over the first
+dimension is the order of Compare.
+*/
+type structure interface {
+	ordered(b box, fn func(rank int) bool) bool
+	count(b box) int
+}
+
+/*
+the positions [start, end) of keys within [low, high], keys ascending
+*/
+func span(keys []int, low, high int) (int, int) {
+	start := sort.SearchInts(keys, low)
+	end := start + sort.Search(len(keys)-start, func(i int) bool {
+		return keys[start+i] > high
+	})
+
+	return start, end
+}
+
+/*
+the last dimension alone, a sorted array
+*/
+type sorted struct {
+	dimension int
+	keys      []int
+	ranks     []int
+}
+
+func (self *sorted) ordered(b box, fn func(rank int) bool) bool {
+	start, end := span(self.keys, b.low[self.dimension-1], b.high[self.dimension-1])
+	for _, rank := range self.ranks[start:end] {
+		if !fn(rank) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (self *sorted) count(b box) int {
+	start, end := span(self.keys, b.low[self.dimension-1], b.high[self.dimension-1])
+	return end - start
+}
+
+/*
+one level of a cascade, every node of the level side by side
+*/
+type level struct {
+	positions []int // of each node, ordered by the value in the last dimension
+	values    []int // in the last dimension at each of positions
+	lefts     []int // how many of the node's positions before this one go left
+}
+
+/*
+cascade covers the last two dimensions.  Its positions are the entries
+ordered by the first of them and form an implicit tree, each node halving
+its span of positions.  Each level of the tree holds the positions of its
+nodes ordered by the last dimension, along with how many of those before
+each one fall in the left child.  A query searches the last dimension
+once, at the root, and follows those counts down to every node it covers
+instead of searching again, which is fractional cascading.
+*/
+type cascade struct {
+	dimension int
+	keys      []int // in dimension at each position, ascending
+	ranks     []int // of the entry at each position
+	levels    []level
+}
+
+func newCascade(dimension int, keys, ranks, last []int) *cascade {
+	c := &cascade{dimension: dimension, keys: keys, ranks: ranks}
+
+	root := make([]int, len(keys))
+	for i := range root {
+		root[i] = i
+	}
+
+	// stable so equal values keep the order of their positions, each child
+	// then holds a subsequence of its parent
+	slices.SortStableFunc(root, func(a, b int) int {
+		return cmp.Compare(last[a], last[b])
+	})
+
+	c.fill(0, 0, len(keys), root, last)
+	return c
+}
+
+/*
+writes the node over positions [start, end), its positions given in order
+of the last dimension, into the level and those below it
+*/
+func (self *cascade) fill(depth, start, end int, positions, last []int) {
+	if depth == len(self.levels) {
+		self.levels = append(self.levels, level{
+			positions: make([]int, len(self.keys)),
+			values:    make([]int, len(self.keys)),
+			lefts:     make([]int, len(self.keys)),
+		})
+	}
+
+	l := self.levels[depth]
+	copy(l.positions[start:end], positions)
+	for i, position := range positions {
+		l.values[start+i] = last[position]
+	}
+
+	if end-start < 2 {
+		return
+	}
+
+	mid := (start + end) / 2
+	left := make([]int, 0, mid-start)
+	right := make([]int, 0, end-mid)
+	for i, position := range positions {
+		l.lefts[start+i] = len(left)
+		if position < mid {
+			left = append(left, position)
+		} else {
+			right = append(right, position)
+		}
+	}
+
+	self.fill(depth+1, start, mid, left, last)
+	self.fill(depth+1, mid, end, right, last)
+}
+
+/*
+where index, within the node over [start, end), lands in each child
+*/
+func (self *cascade) down(depth, start, mid, end, index int) (int, int) {
+	if index == end {
+		return mid, end
+	}
+
+	lefts := self.levels[depth].lefts[index]
+	return start + lefts, mid + (index - start - lefts)
+}
+
+/*
+visits the node over [start, end) whose positions within the last
+dimension bounds are [from, to), along with every node below it within
+the positions [low, high)
+*/
+func (self *cascade) walk(depth, start, end, from, to, low, high int, fn func(depth, from, to int)) {
+	if from >= to || end <= low || high <= start {
+		return
+	}
+
+	if low <= start && end <= high {
+		fn(depth, from, to)
+		return
+	}
+
+	mid := (start + end) / 2
+	leftFrom, rightFrom := self.down(depth, start, mid, end, from)
+	leftTo, rightTo := self.down(depth, start, mid, end, to)
+	self.walk(depth+1, start, mid, leftFrom, leftTo, low, high, fn)
+	self.walk(depth+1, mid, end, rightFrom, rightTo, low, high, fn)
+}
+
+/*
+visits the positions below the node over [start, end) whose spans in the
+last dimension are [from, to), within the positions [low, high), in the
+order of the positions.  Each child's span follows from its parent's, so
+only nodes holding an entry within the query are entered.
+*/
+func (self *cascade) inOrder(depth, start, end, from, to, low, high int, fn func(rank int) bool) bool {
+	if from >= to || end <= low || high <= start {
+		return true
+	}
+
+	if end-start == 1 {
+		return fn(self.ranks[start])
+	}
+
+	mid := (start + end) / 2
+	leftFrom, rightFrom := self.down(depth, start, mid, end, from)
+	leftTo, rightTo := self.down(depth, start, mid, end, to)
+	return self.inOrder(depth+1, start, mid, leftFrom, leftTo, low, high, fn) &&
+		self.inOrder(depth+1, mid, end, rightFrom, rightTo, low, high, fn)
+}
+
+/*
+the positions [low, high) within the query in the first of the two
+dimensions, and the span [from, to) within it in the last at the root
+*/
+func (self *cascade) spans(b box) (int, int, int, int) {
+	low, high := span(self.keys, b.low[self.dimension-1], b.high[self.dimension-1])
+	from, to := span(self.levels[0].values, b.low[self.dimension], b.high[self.dimension])
+	return low, high, from, to
+}
+
+/*
+the nodes covering the query, each with its span of positions in the
+last dimension
+*/
+func (self *cascade) covering(b box, fn func(depth, from, to int)) {
+	if len(self.keys) == 0 {
+		return
+	}
+
+	low, high, from, to := self.spans(b)
+	self.walk(0, 0, len(self.keys), from, to, low, high, fn)
+}
+
+func (self *cascade) ordered(b box, fn func(rank int) bool) bool {
+	if len(self.keys) == 0 {
+		return true
+	}
+
+	low, high, from, to := self.spans(b)
+	return self.inOrder(0, 0, len(self.keys), from, to, low, high, fn)
+}
+
+func (self *cascade) count(b box) int {
+	count := 0
+	self.covering(b, func(_, from, to int) {
+		count += to - from
+	})
+
+	return count
+}
+
+/*
+layer covers one dimension ahead of the last two.  Like a cascade its
+positions form an implicit tree, and each node holds a structure over its
+entries for the next dimension, stored by heap index.
+*/
+type layer struct {
+	dimension int
+	keys      []int
+	nodes     []structure
+}
+
+func (self *layer) walk(index, start, end, low, high int, fn func(structure)) {
+	if end <= low || high <= start {
+		return
+	}
+
+	if low <= start && end <= high {
+		fn(self.nodes[index])
+		return
+	}
+
+	mid := (start + end) / 2
+	self.walk(2*index, start, mid, low, high, fn)
+	self.walk(2*index+1, mid, end, low, high, fn)
+}
+
+func (self *layer) covering(b box, fn func(structure)) {
+	if len(self.keys) == 0 {
+		return
+	}
+
+	low, high := span(self.keys, b.low[self.dimension-1], b.high[self.dimension-1])
+	self.walk(1, 0, len(self.keys), low, high, fn)
+}
+
+/*
+visits the positions below the node at index over [start, end) within
+the positions [low, high), in the order of the positions.  A node whose
+structure counts nothing within the query is not entered.
+*/
+func (self *layer) inOrder(index, start, end, low, high int, b box, fn func(rank int) bool) bool {
+	if end <= low || high <= start || self.nodes[index].count(b) == 0 {
+		return true
+	}
+
+	if end-start == 1 {
+		return self.nodes[index].ordered(b, fn)
+	}
+
+	mid := (start + end) / 2
+	return self.inOrder(2*index, start, mid, low, high, b, fn) &&
+		self.inOrder(2*index+1, mid, end, low, high, b, fn)
+}
+
+func (self *layer) ordered(b box, fn func(rank int) bool) bool {
+	if len(self.keys) == 0 {
+		return true
+	}
+
+	low, high := span(self.keys, b.low[self.dimension-1], b.high[self.dimension-1])
+	return self.inOrder(1, 0, len(self.keys), low, high, b, fn)
+}
+
+func (self *layer) count(b box) int {
+	count := 0
+	self.covering(b, func(s structure) {
+		count += s.count(b)
+	})
+
+	return count
+}
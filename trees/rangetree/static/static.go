@@ -0,0 +1,286 @@
+/*
+Package static is an immutable range tree for data that is built once and
+queried many times.  It implements rangetree.Reader, the query half of a
+RangeTree.
+
+Like v1 it nests a tree over each dimension inside the nodes of the tree
+over the one before, but every tree is implicit: the entries sit in flat
+arrays ordered by a dimension and a node is a span of those arrays, so a
+query follows no pointers.  The last two dimensions use fractional
+cascading, the last dimension is searched once rather than at every node
+covering the query, and so a count costs O(log^(d-1) n).  Space is
+O(n log^(d-1) n), the same as v1.
+
+Queries find their entries in the order of Compare by walking down the
+tree over the first dimension to each of them, so Range allocates nothing
+and stops as soon as its callback does.  In two dimensions the cascade
+takes each step of that walk in O(1), beyond two every node on the way
+counts its nested tree first to skip those holding nothing, so visiting
+an entry costs O(log^(d-1) n) on top of the search.
+*/
+package static
+
+import (
+	"iter"
+	"slices"
+	"sort"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+Options tune the behavior of a tree.  The zero value is the default.
+*/
+type Options struct {
+	/*
+		What to do with entries sharing every coordinate when the tree is
+		built, Replace by default.
+	*/
+	Duplicates r.DuplicateMode
+}
+
+/*
+Tree is a static range tree.  It is never modified once built, so it is
+safe to share between goroutines.
+*/
+type Tree struct {
+	maxDimensions int
+	options       Options
+	entries       []r.Entry // in the order of Compare, a rank indexes it
+	root          structure
+}
+
+/*
+compares the entries at two ranks from dimension on, ties broken by rank
+*/
+func (self *Tree) compareFrom(dimension int) func(a, b int) int {
+	return func(a, b int) int {
+		for d := dimension; d <= self.maxDimensions; d++ {
+			aValue, bValue := self.entries[a].GetDimensionalValue(d), self.entries[b].GetDimensionalValue(d)
+			if aValue < bValue {
+				return -1
+			} else if aValue > bValue {
+				return 1
+			}
+		}
+
+		return a - b
+	}
+}
+
+func (self *Tree) valuesOf(ranks []int, dimension int) []int {
+	values := make([]int, len(ranks))
+	for i, rank := range ranks {
+		values[i] = self.entries[rank].GetDimensionalValue(dimension)
+	}
+
+	return values
+}
+
+/*
+builds the structure for dimension on over ranks, ordered from dimension
+on
+*/
+func (self *Tree) build(dimension int, ranks []int) structure {
+	keys := self.valuesOf(ranks, dimension)
+	switch dimension {
+	case self.maxDimensions:
+		return &sorted{dimension: dimension, keys: keys, ranks: ranks}
+	case self.maxDimensions - 1:
+		return newCascade(dimension, keys, ranks, self.valuesOf(ranks, dimension+1))
+	}
+
+	l := &layer{dimension: dimension, keys: keys, nodes: make([]structure, 4*len(ranks))}
+	self.buildNodes(l, 1, ranks, 0, len(ranks))
+	return l
+}
+
+func (self *Tree) buildNodes(l *layer, index int, ranks []int, start, end int) {
+	if start >= end {
+		return
+	}
+
+	next := slices.Clone(ranks[start:end])
+	slices.SortFunc(next, self.compareFrom(l.dimension+1))
+	l.nodes[index] = self.build(l.dimension+1, next)
+
+	if end-start > 1 {
+		mid := (start + end) / 2
+		self.buildNodes(l, 2*index, ranks, start, mid)
+		self.buildNodes(l, 2*index+1, ranks, mid, end)
+	}
+}
+
+/*
+returns the box for the query, false if it is empty in some dimension
+*/
+func (self *Tree) box(query r.Query) (box, bool) {
+	b := box{make([]int, self.maxDimensions), make([]int, self.maxDimensions)}
+	for i := range b.low {
+		b.low[i], b.high[i] = r.Inclusive(query.GetDimensionalBounds(i + 1))
+		if b.low[i] > b.high[i] {
+			return b, false
+		}
+	}
+
+	return b, true
+}
+
+func (self *Tree) GetRange(query r.Query) []r.Entry {
+	entries := make([]r.Entry, 0)
+	self.Range(query, func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+/*
+The positions of the structure over the first dimension are the ranks
+themselves, so walking down to each entry within the query in the order
+of those positions visits them in the order of Compare.
+*/
+func (self *Tree) Range(query r.Query, fn func(r.Entry) bool) {
+	b, ok := self.box(query)
+	if !ok {
+		return
+	}
+
+	self.root.ordered(b, func(rank int) bool {
+		return fn(self.entries[rank])
+	})
+}
+
+func (self *Tree) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.Range(query, yield)
+	}
+}
+
+func (self *Tree) Count(query r.Query) int {
+	b, ok := self.box(query)
+	if !ok {
+		return 0
+	}
+
+	return self.root.count(b)
+}
+
+/*
+the ranks of the entries at the coordinates
+*/
+func (self *Tree) find(point interface{ GetDimensionalValue(int) int }) (int, int) {
+	compare := func(i int) int {
+		for d := 1; d <= self.maxDimensions; d++ {
+			value, target := self.entries[i].GetDimensionalValue(d), point.GetDimensionalValue(d)
+			if value < target {
+				return -1
+			} else if value > target {
+				return 1
+			}
+		}
+
+		return 0
+	}
+
+	start := sort.Search(len(self.entries), func(i int) bool {
+		return compare(i) >= 0
+	})
+	end := start
+	for end < len(self.entries) && compare(end) == 0 {
+		end++
+	}
+
+	return start, end
+}
+
+func (self *Tree) Get(values ...int) []r.Entry {
+	if len(values) != self.maxDimensions {
+		return nil
+	}
+
+	start, end := self.find(r.Coordinates(values))
+	if start == end {
+		return nil
+	}
+
+	return slices.Clone(self.entries[start:end])
+}
+
+func (self *Tree) Contains(entry r.Entry) bool {
+	if r.ValidateEntries(self.maxDimensions, entry) != nil {
+		return false
+	}
+
+	start, end := self.find(entry)
+	return slices.ContainsFunc(self.entries[start:end], func(e r.Entry) bool {
+		return r.SameEntry(e, entry)
+	})
+}
+
+func (self *Tree) Len() int {
+	return len(self.entries)
+}
+
+/*
+Returns every entry in the order of Compare.
+*/
+func (self *Tree) All() []r.Entry {
+	return slices.Clone(self.entries)
+}
+
+func New(maxDimensions int, entries ...r.Entry) *Tree {
+	return NewWithOptions(maxDimensions, Options{}, entries...)
+}
+
+func NewWithOptions(maxDimensions int, options Options, entries ...r.Entry) *Tree {
+	t, err := NewChecked(maxDimensions, options, entries...)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+/*
+Builds a tree over the entries in O(n log^d n), returning an error
+instead of panicking when an entry is invalid.  The entries are not
+modified.  To freeze another tree pass it its All.
+*/
+func NewChecked(maxDimensions int, options Options, entries ...r.Entry) (*Tree, error) {
+	if err := r.ValidateEntries(maxDimensions, entries...); err != nil {
+		return nil, err
+	}
+
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, func(a, b r.Entry) int {
+		return r.Compare(a, b, maxDimensions)
+	})
+
+	// keep the entries sharing coordinates as inserting them would
+	kept := make([]r.Entry, 0, len(sorted))
+	for i, entry := range sorted {
+		if i == 0 || r.Compare(sorted[i-1], entry, maxDimensions) != 0 {
+			kept = append(kept, entry)
+			continue
+		}
+
+		switch options.Duplicates {
+		case r.Replace:
+			kept[len(kept)-1] = entry
+		case r.Multiset:
+			kept = append(kept, entry)
+		}
+	}
+
+	t := &Tree{maxDimensions: maxDimensions, options: options, entries: kept}
+
+	ranks := make([]int, len(kept))
+	for i := range ranks {
+		ranks[i] = i
+	}
+	t.root = t.build(1, ranks)
+
+	return t, nil
+}
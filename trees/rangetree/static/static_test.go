@@ -0,0 +1,181 @@
+package static
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/v1"
+)
+
+type point struct {
+	coordinates []int
+}
+
+func (self *point) GetDimensionalValue(dimension int) int {
+	return self.coordinates[dimension-1]
+}
+
+func (self *point) MaxDimensions() int {
+	return len(self.coordinates)
+}
+
+func (self *point) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+func randomPoint(rnd *rand.Rand, dimensions, max int) *point {
+	coordinates := make([]int, dimensions)
+	for i := range coordinates {
+		coordinates[i] = rnd.Intn(max)
+	}
+
+	return &point{coordinates}
+}
+
+func randomQuery(rnd *rand.Rand, dimensions, max int) r.Query {
+	bounds := make([]r.Bounds, dimensions)
+	for i := range bounds {
+		switch rnd.Intn(5) {
+		case 0:
+			continue // unbounded
+		case 1:
+			bounds[i] = r.AtLeast(rnd.Intn(max))
+		default:
+			low := rnd.Intn(max)
+			bounds[i] = r.Closed(low, low+rnd.Intn(max))
+		}
+	}
+
+	return r.NewQuery(bounds...)
+}
+
+func checkSame(t *testing.T, expected, received []r.Entry) {
+	if len(expected) != len(received) {
+		t.Fatalf(`Expected len: %d, received: %d`, len(expected), len(received))
+	}
+
+	for i := range expected {
+		if expected[i] != received[i] {
+			t.Fatalf(`Expected: %+v at %d, received: %+v`, expected[i], i, received[i])
+		}
+	}
+}
+
+func TestMatchesLayeredTree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(53))
+
+	for dimensions := 1; dimensions <= 4; dimensions++ {
+		for _, mode := range []r.DuplicateMode{r.Replace, r.Set, r.Multiset} {
+			entries := make([]r.Entry, 0, 300)
+			for i := 0; i < 300; i++ {
+				entries = append(entries, randomPoint(rnd, dimensions, 12))
+			}
+
+			frozen := NewWithOptions(dimensions, Options{Duplicates: mode}, entries...)
+			layered := v1.NewWithOptions(dimensions, v1.Options{Duplicates: mode}, entries...)
+			checkSame(t, layered.All(), frozen.All())
+
+			for i := 0; i < 100; i++ {
+				query := randomQuery(rnd, dimensions, 12)
+				checkSame(t, layered.GetRange(query), frozen.GetRange(query))
+
+				if expected, received := layered.Count(query), frozen.Count(query); expected != received {
+					t.Fatalf(`%d dimensions %s: expected count: %d, received: %d`,
+						dimensions, mode, expected, received)
+				}
+
+				p := randomPoint(rnd, dimensions, 12)
+				checkSame(t, layered.Get(p.coordinates...), frozen.Get(p.coordinates...))
+				for _, e := range []r.Entry{p, entries[rnd.Intn(len(entries))]} {
+					if layered.Contains(e) != frozen.Contains(e) {
+						t.Fatalf(`%d dimensions %s: expected Contains to agree on %+v`, dimensions, mode, e)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEmptyAndStopping(t *testing.T) {
+	for dimensions := 1; dimensions <= 3; dimensions++ {
+		tree := New(dimensions)
+		if tree.Len() != 0 || tree.Count(r.NewQuery()) != 0 || len(tree.GetRange(r.NewQuery())) != 0 {
+			t.Errorf(`Expected an empty tree in %d dimensions to find nothing.`, dimensions)
+		}
+	}
+
+	tree := New(2, &point{[]int{1, 1}}, &point{[]int{1, 2}}, &point{[]int{2, 1}})
+	visited := 0
+	tree.Range(r.NewQuery(), func(r.Entry) bool {
+		visited++
+		return false
+	})
+
+	if visited != 1 {
+		t.Errorf(`Expected to stop after %d, received: %d`, 1, visited)
+	}
+
+	if count := tree.Count(r.NewQuery(r.Open(1, 2))); count != 0 {
+		t.Errorf(`Expected an empty query to count nothing, received: %d`, count)
+	}
+
+	if nearest := r.Nearest(tree, []int{2, 2}, 1, r.Manhattan); len(nearest) != 1 || nearest[0].GetDimensionalValue(2) != 2 {
+		t.Errorf(`Expected the tree to serve as a Reader, received: %+v`, nearest)
+	}
+
+	if tree.Get(1) != nil {
+		t.Errorf(`Expected too few coordinates to find nothing.`)
+	}
+}
+
+func TestRangeDoesNotGather(t *testing.T) {
+	rnd := rand.New(rand.NewSource(59))
+
+	for dimensions := 1; dimensions <= 3; dimensions++ {
+		entries := make([]r.Entry, 0, 2000)
+		for i := 0; i < 2000; i++ {
+			entries = append(entries, randomPoint(rnd, dimensions, 100))
+		}
+		tree := New(dimensions, entries...)
+
+		visited := 0
+		allocs := testing.AllocsPerRun(10, func() {
+			tree.Range(r.NewQuery(), func(r.Entry) bool {
+				visited++
+				return true
+			})
+		})
+
+		if visited != 11*tree.Len() || allocs > 4 {
+			t.Errorf(`%d dimensions: expected every entry without gathering them, received: %d, %v allocations`,
+				dimensions, visited, allocs)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := NewChecked(2, Options{}, &point{[]int{1}}); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	if _, err := NewChecked(2, Options{}, nil); !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	entries := make([]r.Entry, 0, 1<<15)
+	for i := 0; i < 1<<15; i++ {
+		entries = append(entries, randomPoint(rnd, 3, 1<<10))
+	}
+	tree := New(3, entries...)
+	query := r.NewQuery(r.Closed(100, 800), r.Closed(200, 900), r.Closed(0, 500))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Count(query)
+	}
+}
@@ -0,0 +1,133 @@
+package v1
+
+import (
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+Aggregator describes a monoid over entries, such as a sum, minimum or
+maximum of a value they carry.  Combine must be associative and Identity
+must leave any value unchanged when combined with it.  Values are combined
+in entry order, so Combine need not be commutative.
+*/
+type Aggregator struct {
+	Identity any
+	Lift     func(entry r.Entry) any
+	Combine  func(a, b any) any
+}
+
+/*
+recomputes the duplicates counted below this node and its aggregate from
+its entries or its children.  Only last dimension nodes keep either, in
+earlier dimensions the later dimensions of a query still have to be
+applied below every leaf.
+*/
+func (self *node) refresh(tree *tree) {
+	if !self.isLeaf() && tree.isLastDimension() {
+		self.numDuplicates = self.left.duplicatesBelow() + self.right.duplicatesBelow()
+	}
+
+	aggregator := tree.options.Aggregator
+	if aggregator == nil || !tree.isLastDimension() {
+		return
+	}
+
+	if !self.isLeaf() {
+		self.aggregate = aggregator.Combine(self.left.aggregate, self.right.aggregate)
+		return
+	}
+
+	aggregate := aggregator.Lift(self.entry)
+	for _, entry := range self.duplicates {
+		aggregate = aggregator.Combine(aggregate, aggregator.Lift(entry))
+	}
+	self.aggregate = aggregate
+}
+
+/*
+aggregates the entries below this node that fall within the query, a
+subtree covered by the query in the last dimension contributes its
+aggregate without being walked
+*/
+func (self *node) aggregateRange(tree *tree, query r.Query, left, right bool) any {
+	aggregator := tree.options.Aggregator
+	low, high := r.Inclusive(query.GetDimensionalBounds(tree.dimension))
+	if self.isLeaf() {
+		if self.value < low || self.value > high {
+			return aggregator.Identity
+		}
+
+		return self.aggregateCovered(tree, query)
+	}
+
+	if high < self.value {
+		return self.left.aggregateRange(tree, query, left, right)
+	}
+
+	if low > self.value {
+		return self.right.aggregateRange(tree, query, left, right)
+	}
+
+	if left {
+		return aggregator.Combine(
+			self.left.aggregateRange(tree, query, true, false),
+			self.right.aggregateCovered(tree, query),
+		)
+	} else if right {
+		return aggregator.Combine(
+			self.left.aggregateCovered(tree, query),
+			self.right.aggregateRange(tree, query, false, true),
+		)
+	}
+
+	return aggregator.Combine(
+		self.left.aggregateRange(tree, query, true, false),
+		self.right.aggregateRange(tree, query, false, true),
+	)
+}
+
+/*
+aggregates the entries below a node whose values all fall within the query
+in this dimension, the counterpart of countCovered.  Only the last
+dimension keeps aggregates, earlier ones visit every leaf below the node
+and search its nested tree.
+*/
+func (self *node) aggregateCovered(tree *tree, query r.Query) any {
+	if tree.isLastDimension() {
+		return self.aggregate
+	}
+
+	if self.isLeaf() {
+		return self.rt.aggregateRange(query)
+	}
+
+	return tree.options.Aggregator.Combine(
+		self.left.aggregateCovered(tree, query),
+		self.right.aggregateCovered(tree, query),
+	)
+}
+
+func (self *tree) aggregateRange(query r.Query) any {
+	if self.root == nil {
+		return self.options.Aggregator.Identity
+	}
+
+	return self.root.aggregateRange(self, query, false, false)
+}
+
+/*
+Combines the entries within the query with the tree's Aggregator, in
+entry order.  Aggregates are kept in the last dimension only, so like
+Count this is O(log n) calls to Combine in one dimension, beyond that it
+grows with the number of distinct values the query covers in the
+dimensions before the last, each costing a search of a nested tree, rather
+than with the number of entries combined.  Returns nil if the tree was
+built without an Aggregator.
+*/
+func (self *tree) Aggregate(query r.Query) any {
+	if self.options.Aggregator == nil {
+		return nil
+	}
+
+	return self.aggregateRange(query)
+}
@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+func weight(entry r.Entry) int {
+	return entry.GetDimensionalValue(1)*1000 + entry.GetDimensionalValue(2)
+}
+
+var sum = &Aggregator{
+	Identity: 0,
+	Lift: func(entry r.Entry) any {
+		return weight(entry)
+	},
+	Combine: func(a, b any) any {
+		return a.(int) + b.(int)
+	},
+}
+
+func bruteForceSum(entries []r.Entry, q *query) int {
+	total := 0
+	for _, entry := range entries {
+		x, y := entry.GetDimensionalValue(1), entry.GetDimensionalValue(2)
+		if x >= q.coordinates[0].low && x < q.coordinates[0].high &&
+			y >= q.coordinates[1].low && y < q.coordinates[1].high {
+			total += weight(entry)
+		}
+	}
+
+	return total
+}
+
+func checkSums(t *testing.T, rnd *rand.Rand, tree *tree, max int) {
+	entries := tree.All()
+	for i := 0; i < 20; i++ {
+		x, y := rnd.Intn(max+2)-1, rnd.Intn(max+2)-1
+		q := newQuery(x, x+rnd.Intn(max), y, y+rnd.Intn(max))
+
+		expected := bruteForceSum(entries, q)
+		if received := tree.Aggregate(q); received != expected {
+			t.Errorf(`Expected sum: %d, received: %v for %+v`, expected, received, q)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tree := NewWithOptions(2, Options{Aggregator: sum},
+		newPoint(0, 0), newPoint(0, 1), newPoint(1, 1), newPoint(2, 3))
+
+	if received := tree.Aggregate(newQuery(0, 2, 0, 2)); received != 1+1001 {
+		t.Errorf(`Expected sum: %d, received: %v`, 1+1001, received)
+	}
+
+	if received := tree.Aggregate(newQuery(5, 6, 0, 10)); received != 0 {
+		t.Errorf(`Expected the identity, received: %v`, received)
+	}
+
+	if received := New(2, newPoint(0, 0)).Aggregate(newQuery(0, 1, 0, 1)); received != nil {
+		t.Errorf(`Expected nil without an aggregator, received: %v`, received)
+	}
+
+	tree.Clear()
+	if received := tree.Aggregate(newQuery(0, 10, 0, 10)); received != 0 {
+		t.Errorf(`Expected the identity, received: %v`, received)
+	}
+}
+
+func TestAggregateOrder(t *testing.T) {
+	concat := &Aggregator{
+		Identity: ``,
+		Lift: func(entry r.Entry) any {
+			return string(rune('a' + entry.GetDimensionalValue(2)))
+		},
+		Combine: func(a, b any) any {
+			return a.(string) + b.(string)
+		},
+	}
+
+	tree := NewWithOptions(2, Options{Aggregator: concat}, newPoint(0, 3), newPoint(0, 0), newPoint(0, 2))
+	tree.Insert(newPoint(0, 1), newPoint(0, 5))
+
+	if received := tree.Aggregate(newQuery(0, 1, 0, 5)); received != `abcd` {
+		t.Errorf(`Expected: %s, received: %v`, `abcd`, received)
+	}
+}
+
+func TestAggregateMaintainedThroughWrites(t *testing.T) {
+	rnd := rand.New(rand.NewSource(41))
+	max := 25
+
+	for _, mode := range []r.DuplicateMode{r.Replace, r.Multiset} {
+		summed := NewWithOptions(2, Options{Aggregator: sum, Duplicates: mode})
+		for i := 0; i < 300; i++ {
+			summed.Insert(newRow(rnd.Intn(max), rnd.Intn(max)))
+		}
+		checkSums(t, rnd, summed, max)
+
+		for i := 0; i < 60; i++ {
+			entries := summed.All()
+			switch rnd.Intn(4) {
+			case 0:
+				summed.Remove(entries[rnd.Intn(len(entries))])
+			case 1:
+				old := entries[rnd.Intn(len(entries))]
+				summed.Update(old, newRow(rnd.Intn(max), rnd.Intn(max)))
+			case 2:
+				x, y := rnd.Intn(max), rnd.Intn(max)
+				summed.RemoveRange(newQuery(x, x+3, y, y+3))
+			case 3:
+				summed.Shift(rnd.Intn(2)+1, rnd.Intn(max), rnd.Intn(5)-2)
+			}
+
+			batch := make([]r.Entry, 0, 10)
+			for j := 0; j < 10; j++ {
+				batch = append(batch, newRow(rnd.Intn(max), rnd.Intn(max)))
+			}
+			summed.Insert(batch...)
+
+			checkSums(t, rnd, summed, max)
+		}
+
+		checkTreeCounts(t, summed)
+		checkSums(t, rnd, summed.Copy().(*tree), max)
+	}
+}
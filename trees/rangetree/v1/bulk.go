@@ -0,0 +1,118 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+Returned by NewSorted and NewFromSeq when the entries are not in order,
+match it with errors.Is.
+*/
+var ErrUnsorted = errors.New(`rangetree: entries are not sorted`)
+
+/*
+Builds a tree from entries already ordered by dimension 1, then dimension
+2 and so on, as a database returns rows ordered by (row, col).  The order
+is checked in one pass rather than sorted and the tree is built in time
+linear in the number of entries per dimension.  Entries sharing every
+coordinate are kept according to options.Duplicates.  The slice is not
+modified or retained.
+*/
+func NewSorted(maxDimensions int, options Options, entries []r.Entry) (*tree, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.ValidateEntries(maxDimensions, entries...); err != nil {
+		return nil, err
+	}
+
+	for i := 1; i < len(entries); i++ {
+		if r.Compare(entries[i-1], entries[i], maxDimensions) > 0 {
+			return nil, fmt.Errorf(`%w: entry %d comes before entry %d`, ErrUnsorted, i, i-1)
+		}
+	}
+
+	return newSorted(&options, maxDimensions, 1, entries), nil
+}
+
+/*
+NewSorted for entries that arrive one at a time, from a database cursor
+for instance.  Only the entries sharing the current value in dimension 1
+are held at once besides the tree itself.  The sequence is read to the
+end unless an entry is invalid or out of order.
+*/
+func NewFromSeq(maxDimensions int, options Options, entries iter.Seq[r.Entry]) (*tree, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	t := &tree{
+		maxDimensions: maxDimensions,
+		dimension:     1,
+		options:       &options,
+	}
+
+	leaves := make([]*node, 0)
+	group := make([]r.Entry, 0)
+
+	// turns the group of entries sharing a value in dimension 1 into a leaf
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+
+		if t.isLastDimension() {
+			leaves = append(leaves, t.newLeaf(group))
+		} else {
+			leaves = append(leaves, &node{
+				value: group[0].GetDimensionalValue(1),
+				rt:    newSorted(t.options, maxDimensions, 2, group),
+			})
+		}
+
+		clear(group)
+		group = group[:0]
+	}
+
+	var prev r.Entry
+	i := 0
+	for entry := range entries {
+		if entry == nil {
+			return nil, fmt.Errorf(`%w: entry %d`, r.ErrNilEntry, i)
+		}
+
+		if entry.MaxDimensions() != maxDimensions {
+			return nil, fmt.Errorf(
+				`%w: entry %d has %d dimensions, the tree has %d`,
+				r.ErrDimensionMismatch, i, entry.MaxDimensions(), maxDimensions,
+			)
+		}
+
+		if prev != nil {
+			if r.Compare(prev, entry, maxDimensions) > 0 {
+				return nil, fmt.Errorf(`%w: entry %d comes before entry %d`, ErrUnsorted, i, i-1)
+			}
+
+			if prev.GetDimensionalValue(1) != entry.GetDimensionalValue(1) {
+				flush()
+			}
+		}
+
+		group = append(group, entry)
+		prev = entry
+		i++
+	}
+	flush()
+
+	if len(leaves) > 0 {
+		t.root = buildFromLeaves(t, leaves)
+		t.numChildren = t.root.numEntries()
+	}
+
+	return t, nil
+}
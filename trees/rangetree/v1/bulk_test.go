@@ -0,0 +1,120 @@
+package v1
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+func sortedPoints(rnd *rand.Rand, num, max int) ([]*point, []r.Entry) {
+	points := randomPoints(rnd, num, max)
+	entries := make([]r.Entry, len(points))
+	for i, p := range points {
+		entries[i] = p
+	}
+
+	slices.SortFunc(entries, func(a, b r.Entry) int {
+		return r.Compare(a, b, 2)
+	})
+
+	return points, entries
+}
+
+func TestNewSortedMatchesNew(t *testing.T) {
+	rnd := rand.New(rand.NewSource(29))
+	points, entries := sortedPoints(rnd, 500, 40)
+
+	tree, err := NewSorted(2, Options{}, entries)
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkTreeCounts(t, tree)
+	checkBalanced(t, tree, DefaultBalance)
+	checkRandomCounts(t, rnd, tree, points, 40)
+
+	if depth(tree.root) != depth(New(2, entries...).root) {
+		t.Errorf(`Expected the same depth as New.`)
+	}
+}
+
+func TestNewFromSeqMatchesNew(t *testing.T) {
+	rnd := rand.New(rand.NewSource(31))
+	points, entries := sortedPoints(rnd, 500, 40)
+
+	tree, err := NewFromSeq(2, Options{}, slices.Values(entries))
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkTreeCounts(t, tree)
+	checkBalanced(t, tree, DefaultBalance)
+	checkRandomCounts(t, rnd, tree, points, 40)
+
+	p := newPoint(100, 100)
+	tree.Insert(p)
+	if !tree.Contains(p) || tree.Len() != 501 {
+		t.Errorf(`Expected the loaded tree to accept inserts.`)
+	}
+}
+
+func TestNewSortedDuplicates(t *testing.T) {
+	first, second := newPoint(1, 1), newPoint(1, 1)
+	entries := []r.Entry{newPoint(0, 0), first, second, newPoint(2, 0)}
+
+	tree, err := NewSorted(2, Options{}, entries)
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	if got := tree.Get(1, 1); len(got) != 1 || got[0] != second {
+		t.Errorf(`Expected the last duplicate, received: %+v`, got)
+	}
+
+	tree, err = NewFromSeq(2, Options{Duplicates: r.Multiset}, slices.Values(entries))
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkLen(t, tree.Get(1, 1), 2)
+	checkTreeCounts(t, tree)
+}
+
+func TestNewSortedRejectsUnsorted(t *testing.T) {
+	entries := []r.Entry{newPoint(0, 0), newPoint(1, 1), newPoint(1, 0)}
+
+	if _, err := NewSorted(2, Options{}, entries); !errors.Is(err, ErrUnsorted) {
+		t.Errorf(`Expected unsorted, received: %v`, err)
+	}
+
+	if _, err := NewFromSeq(2, Options{}, slices.Values(entries)); !errors.Is(err, ErrUnsorted) {
+		t.Errorf(`Expected unsorted, received: %v`, err)
+	}
+
+	entries[2] = nil
+	if _, err := NewFromSeq(2, Options{}, slices.Values(entries)); !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+
+	tree, err := NewFromSeq(2, Options{}, slices.Values([]r.Entry{}))
+	if err != nil || tree.Len() != 0 || tree.root != nil {
+		t.Errorf(`Expected an empty tree, received: %+v, %v`, tree, err)
+	}
+}
+
+func BenchmarkNewSorted(b *testing.B) {
+	numItems := 100000
+
+	points := make([]r.Entry, numItems)
+	for i := 0; i < numItems; i++ {
+		points[i] = newPoint(i/100, i%100)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewSorted(2, Options{}, points)
+	}
+}
@@ -1,7 +1,7 @@
 package v1
 
 import (
-	"log"
+	"fmt"
 	"sort"
 
 	r "github.com/dzyp/data/trees/rangetree"
@@ -15,7 +15,7 @@ func (dimension byDimension) Sort(entries []r.Entry) {
 		dimension: int(dimension),
 	}
 
-	sort.Sort(es)
+	sort.Stable(es) // keeps duplicates in the order they were given
 }
 
 type entrySorter struct {
@@ -102,8 +102,8 @@ func (self *entriesWrapper) split(index int) (*entriesWrapper, *entriesWrapper)
 
 	for _, entry := range leftSortedList {
 		entries, ok := self.groups[entry]
-		if !ok {
-			log.Fatal(`Error in split, entries not matching.`)
+		if !ok { // entries are validated on the way in so this can't happen
+			panic(fmt.Errorf(`%w: split entries not matching`, r.ErrInconsistentOrder))
 		}
 
 		midPoint += len(entries)
@@ -112,8 +112,8 @@ func (self *entriesWrapper) split(index int) (*entriesWrapper, *entriesWrapper)
 
 	for _, entry := range rightSortedList {
 		entries, ok := self.groups[entry]
-		if !ok {
-			log.Fatal(`Error in split, entries not matching.`)
+		if !ok { // entries are validated on the way in so this can't happen
+			panic(fmt.Errorf(`%w: split entries not matching`, r.ErrInconsistentOrder))
 		}
 
 		rightGroup[entry] = entries
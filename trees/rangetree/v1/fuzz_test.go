@@ -0,0 +1,23 @@
+package v1
+
+import (
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/rangetreetest"
+)
+
+/*
+Decodes the input into operations on a tree and a naive reference and
+fails on the first difference, see rangetreetest.RunOperations.  The seed
+corpus is in testdata/fuzz, run with
+
+	go test -fuzz FuzzMatchesReference ./trees/rangetree/v1
+*/
+func FuzzMatchesReference(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rangetreetest.RunOperations(t, func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+			return New(maxDimensions, entries...)
+		}, data)
+	})
+}
@@ -0,0 +1,251 @@
+package v1
+
+import (
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+the leaf following this one in value order, nil at the last
+*/
+func (self *node) nextLeaf() *node {
+	n := self
+	for !n.isRoot() && n.isRight() {
+		n = n.parent
+	}
+
+	if n.isRoot() {
+		return nil
+	}
+
+	n = n.parent.right
+	for !n.isLeaf() {
+		n = n.left
+	}
+
+	return n
+}
+
+/*
+the leaf preceding this one in value order, nil at the first
+*/
+func (self *node) prevLeaf() *node {
+	n := self
+	for !n.isRoot() && n.isLeft() {
+		n = n.parent
+	}
+
+	if n.isRoot() {
+		return nil
+	}
+
+	n = n.parent.left
+	for !n.isLeaf() {
+		n = n.right
+	}
+
+	return n
+}
+
+/*
+the neighbouring leaf in the given direction
+*/
+func (self *node) next(forward bool) *node {
+	if forward {
+		return self.nextLeaf()
+	}
+
+	return self.prevLeaf()
+}
+
+/*
+descends to the leaf nearest value, either the last leaf <= value or the
+first leaf > value.  Stale keys left by removals can send the descent to
+the latter.
+*/
+func (self *node) closest(value int) *node {
+	n := self
+	for !n.isLeaf() {
+		if value >= n.value {
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	return n
+}
+
+/*
+the last dimension leaf first (or last) in Compare order below this node
+*/
+func (self *node) edge(last bool) *node {
+	n := self
+	for {
+		for !n.isLeaf() {
+			if last {
+				n = n.right
+			} else {
+				n = n.left
+			}
+		}
+
+		if n.rt == nil {
+			return n
+		}
+		n = n.rt.root
+	}
+}
+
+/*
+the entry at the leaf, the first or last of a multiset leaf
+*/
+func (self *node) edgeEntry(last bool) r.Entry {
+	if last && len(self.duplicates) > 0 {
+		return self.duplicates[len(self.duplicates)-1]
+	}
+
+	return self.entry
+}
+
+/*
+steps along dimension from point, forward or back, to the first key whose
+leaf holds an entry matching point in every other dimension
+*/
+func (self *tree) step(point valuer, dimension int, forward bool) *node {
+	if self.root == nil {
+		return nil
+	}
+
+	value := point.GetDimensionalValue(self.dimension)
+	if self.dimension < dimension {
+		n := self.root.find(value)
+		if n == nil {
+			return nil
+		}
+
+		return n.rt.step(point, dimension, forward)
+	}
+
+	n := self.root.closest(value)
+	if forward && n.value <= value {
+		n = n.nextLeaf()
+	} else if !forward && n.value >= value {
+		n = n.prevLeaf()
+	}
+
+	for ; n != nil; n = n.next(forward) {
+		if n.rt == nil {
+			return n
+		}
+
+		if leaf := n.rt.find(point); leaf != nil {
+			return leaf
+		}
+	}
+
+	return nil
+}
+
+func (self *tree) navigate(dimension int, values []int, forward bool) (r.Entry, bool) {
+	if len(values) != self.maxDimensions || dimension < 1 || dimension > self.maxDimensions {
+		return nil, false
+	}
+
+	n := self.step(r.Coordinates(values), dimension, forward)
+	if n == nil {
+		return nil, false
+	}
+
+	return n.entry, true
+}
+
+/*
+Returns the entry at the nearest coordinate after values along dimension
+whose values in every other dimension match, like jumping to the next
+filled cell of a spreadsheet row.  values holds a coordinate for each
+dimension and need not be occupied itself.  Where several entries share
+the coordinate the first, as returned by Get, is returned.
+
+Each dimension costs a descent of O(log n) plus a step through the leaves
+along dimension.  A key along dimension that holds no entry matching the
+later dimensions is skipped at the cost of one lookup, so in the last
+dimension, and whenever the next key matches, the whole call is O(log n)
+per dimension.
+*/
+func (self *tree) Next(dimension int, values ...int) (r.Entry, bool) {
+	return self.navigate(dimension, values, true)
+}
+
+/*
+Next in the other direction, the nearest coordinate before values.
+*/
+func (self *tree) Prev(dimension int, values ...int) (r.Entry, bool) {
+	return self.navigate(dimension, values, false)
+}
+
+/*
+returns the leaf with the lowest (or highest) value in dimension, the
+first (or last) in Compare order among equals
+*/
+func (self *tree) extreme(dimension int, last bool) *node {
+	if self.root == nil {
+		return nil
+	}
+
+	if self.dimension == dimension {
+		return self.root.edge(last)
+	}
+
+	// nothing orders the later dimensions across keys of this one, each
+	// key's nested tree is asked in turn
+	var result *node
+	self.root.leaves(func(leaf *node) {
+		n := leaf.rt.extreme(dimension, last)
+		if n == nil {
+			return
+		}
+
+		if result == nil {
+			result = n
+			return
+		}
+
+		value, best := n.entry.GetDimensionalValue(dimension), result.entry.GetDimensionalValue(dimension)
+		if (!last && value < best) || (last && value >= best) {
+			result = n
+		}
+	})
+
+	return result
+}
+
+func (self *tree) bound(dimension int, last bool) (r.Entry, bool) {
+	if dimension < 1 || dimension > self.maxDimensions {
+		return nil, false
+	}
+
+	n := self.extreme(dimension, last)
+	if n == nil {
+		return nil, false
+	}
+
+	return n.edgeEntry(last), true
+}
+
+/*
+Returns an entry with the lowest value in dimension, the first in Compare
+order if several share it.  For dimension 1 this is O(log n) per
+dimension.  Later dimensions are not ordered across the keys of earlier
+ones, so their nested trees are each descended in turn.
+*/
+func (self *tree) Min(dimension int) (r.Entry, bool) {
+	return self.bound(dimension, false)
+}
+
+/*
+Returns an entry with the highest value in dimension, the last in Compare
+order if several share it.  The cost is that of Min.
+*/
+func (self *tree) Max(dimension int) (r.Entry, bool) {
+	return self.bound(dimension, true)
+}
@@ -0,0 +1,168 @@
+package v1
+
+import (
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+the nearest coordinate along dimension from values with every other
+coordinate matching, found by scanning
+*/
+func bruteForceStep(entries []r.Entry, dimension int, values []int, forward bool) (r.Entry, bool) {
+	var result r.Entry
+	for _, entry := range entries {
+		matches := true
+		for d := 1; d <= len(values); d++ {
+			if d != dimension && entry.GetDimensionalValue(d) != values[d-1] {
+				matches = false
+			}
+		}
+
+		value := entry.GetDimensionalValue(dimension)
+		if !matches || (forward && value <= values[dimension-1]) || (!forward && value >= values[dimension-1]) {
+			continue
+		}
+
+		if result == nil ||
+			(forward && value < result.GetDimensionalValue(dimension)) ||
+			(!forward && value > result.GetDimensionalValue(dimension)) {
+			result = entry
+		}
+	}
+
+	return result, result != nil
+}
+
+func TestNextPrevSpreadsheet(t *testing.T) {
+	tree := New(2, newPoint(1, 1), newPoint(1, 4), newPoint(1, 9), newPoint(6, 4))
+
+	if entry, ok := tree.Next(2, 1, 1); !ok || entry.GetDimensionalValue(2) != 4 {
+		t.Errorf(`Expected (1, 4), received: %+v`, entry)
+	}
+
+	if entry, ok := tree.Next(2, 1, 5); !ok || entry.GetDimensionalValue(2) != 9 {
+		t.Errorf(`Expected (1, 9) from an empty cell, received: %+v`, entry)
+	}
+
+	if entry, ok := tree.Next(2, 1, 9); ok {
+		t.Errorf(`Expected nothing after the last cell, received: %+v`, entry)
+	}
+
+	if entry, ok := tree.Prev(2, 1, 9); !ok || entry.GetDimensionalValue(2) != 4 {
+		t.Errorf(`Expected (1, 4), received: %+v`, entry)
+	}
+
+	if entry, ok := tree.Next(1, 1, 4); !ok || entry.GetDimensionalValue(1) != 6 {
+		t.Errorf(`Expected (6, 4), received: %+v`, entry)
+	}
+
+	if entry, ok := tree.Next(1, 1, 9); ok {
+		t.Errorf(`Expected no row below in that column, received: %+v`, entry)
+	}
+
+	if entry, ok := tree.Prev(1, 3, 4); !ok || entry.GetDimensionalValue(1) != 1 {
+		t.Errorf(`Expected (1, 4), received: %+v`, entry)
+	}
+
+	if _, ok := tree.Next(3, 1, 1); ok {
+		t.Errorf(`Expected an invalid dimension to find nothing.`)
+	}
+
+	if _, ok := tree.Next(1, 1); ok {
+		t.Errorf(`Expected too few values to find nothing.`)
+	}
+
+	if _, ok := New(2).Prev(1, 0, 0); ok {
+		t.Errorf(`Expected an empty tree to find nothing.`)
+	}
+}
+
+func TestNextPrevMatchBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(29))
+	tree := New(2)
+
+	for i := 0; i < 400; i++ {
+		tree.Insert(newPoint(rnd.Intn(30), rnd.Intn(30)))
+		if i%4 == 0 { // leave stale keys behind
+			all := tree.All()
+			tree.Remove(all[rnd.Intn(len(all))])
+		}
+
+		entries := tree.All()
+		values := []int{rnd.Intn(34) - 2, rnd.Intn(34) - 2}
+		dimension := rnd.Intn(2) + 1
+		forward := rnd.Intn(2) == 0
+
+		expected, expectedOK := bruteForceStep(entries, dimension, values, forward)
+		var received r.Entry
+		var ok bool
+		if forward {
+			received, ok = tree.Next(dimension, values...)
+		} else {
+			received, ok = tree.Prev(dimension, values...)
+		}
+
+		if ok != expectedOK || (ok && r.Compare(expected, received, 2) != 0) {
+			t.Fatalf(`From %v along %d forward %t expected: %+v, received: %+v`,
+				values, dimension, forward, expected, received)
+		}
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	tree := New(2)
+	if _, ok := tree.Min(1); ok {
+		t.Errorf(`Expected an empty tree to have no min.`)
+	}
+
+	rnd := rand.New(rand.NewSource(31))
+	for i := 0; i < 200; i++ {
+		tree.Insert(newPoint(rnd.Intn(100)-50, rnd.Intn(100)-50))
+	}
+
+	entries := tree.All()
+	for dimension := 1; dimension <= 2; dimension++ {
+		first, last := entries[0], entries[0]
+		for _, entry := range entries {
+			value := entry.GetDimensionalValue(dimension)
+			if value < first.GetDimensionalValue(dimension) {
+				first = entry
+			}
+			if value >= last.GetDimensionalValue(dimension) {
+				last = entry
+			}
+		}
+
+		if entry, ok := tree.Min(dimension); !ok || entry != first {
+			t.Errorf(`Expected min: %+v, received: %+v`, first, entry)
+		}
+
+		if entry, ok := tree.Max(dimension); !ok || entry != last {
+			t.Errorf(`Expected max: %+v, received: %+v`, last, entry)
+		}
+	}
+
+	if _, ok := tree.Max(0); ok {
+		t.Errorf(`Expected an invalid dimension to have no max.`)
+	}
+}
+
+func TestMinMaxMultiset(t *testing.T) {
+	a, b, c := &tagged{*newPoint(1, 2), 1}, &tagged{*newPoint(1, 2), 2}, &tagged{*newPoint(3, 0), 3}
+	tree := NewWithOptions(2, Options{Duplicates: r.Multiset}, a, b, c)
+
+	if entry, _ := tree.Min(1); entry != a {
+		t.Errorf(`Expected the first entry, received: %+v`, entry)
+	}
+
+	if entry, _ := tree.Max(2); entry != b {
+		t.Errorf(`Expected the last entry, received: %+v`, entry)
+	}
+
+	if entry, _ := tree.Prev(1, 3, 2); entry != a {
+		t.Errorf(`Expected the first entry, received: %+v`, entry)
+	}
+}
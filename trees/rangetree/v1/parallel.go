@@ -0,0 +1,52 @@
+package v1
+
+import "runtime"
+
+/*
+one token for every goroutine building a subtree, shared by every tree so
+that concurrent builds together stay within GOMAXPROCS
+*/
+var workers = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+func (self *Options) parallelThreshold() int {
+	if self.ParallelThreshold == 0 {
+		return DefaultParallelThreshold
+	}
+
+	return self.ParallelThreshold
+}
+
+/*
+runs a and b, which must touch disjoint parts of the tree, and returns
+once both are done.  b gets its own goroutine when size reaches the
+parallel threshold and a worker is free, otherwise both run here.
+Never waiting for a worker keeps nested forks from deadlocking.
+*/
+func (self *tree) fork(size int, a, b func()) {
+	threshold := self.options.parallelThreshold()
+	if threshold < 0 || size < threshold {
+		a()
+		b()
+		return
+	}
+
+	select {
+	case workers <- struct{}{}:
+	default:
+		a()
+		b()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer func() {
+			<-workers
+			close(done)
+		}()
+		b()
+	}()
+
+	a()
+	<-done
+}
@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+func checkSameTree(t *testing.T, expected, received *tree) {
+	if expected.numChildren != received.numChildren {
+		t.Errorf(`Expected num children: %d, received: %d`, expected.numChildren, received.numChildren)
+	}
+
+	var walk func(a, b *node)
+	walk = func(a, b *node) {
+		if a == nil || b == nil {
+			if a != b {
+				t.Errorf(`Expected both nodes to be nil, received: %+v, %+v`, a, b)
+			}
+			return
+		}
+
+		if a.value != b.value || a.numChildren != b.numChildren || a.entry != b.entry {
+			t.Errorf(`Expected node: %+v, received: %+v`, a, b)
+			return
+		}
+
+		if a.rt != nil || b.rt != nil {
+			if a.rt == nil || b.rt == nil {
+				t.Errorf(`Expected both nodes to hold a tree.`)
+				return
+			}
+			checkSameTree(t, a.rt, b.rt)
+		}
+
+		walk(a.left, b.left)
+		walk(a.right, b.right)
+	}
+
+	walk(expected.root, received.root)
+}
+
+func TestParallelBuildMatchesSerial(t *testing.T) {
+	rnd := rand.New(rand.NewSource(37))
+	points := randomPoints(rnd, 5000, 200)
+	entries := make([]r.Entry, len(points))
+	for i, p := range points {
+		entries[i] = p
+	}
+
+	serial := NewWithOptions(2, Options{ParallelThreshold: -1}, entries...)
+	parallel := NewWithOptions(2, Options{ParallelThreshold: 1}, entries...)
+	checkSameTree(t, serial, parallel)
+	checkTreeCounts(t, parallel)
+
+	sorted := serial.All()
+	serial, _ = NewSorted(2, Options{ParallelThreshold: -1}, sorted)
+	parallel, _ = NewSorted(2, Options{ParallelThreshold: 1}, sorted)
+	checkSameTree(t, serial, parallel)
+
+	more := randomPoints(rnd, 3000, 300)
+	batch := make([]r.Entry, len(more))
+	for i, p := range more {
+		batch[i] = p
+	}
+
+	serial.Insert(batch...)
+	parallel.Insert(batch...)
+	checkSameTree(t, serial, parallel)
+	checkTreeCounts(t, parallel)
+}
+
+func BenchmarkParallelBuild(b *testing.B) {
+	numItems := 1000000
+
+	points := make([]r.Entry, numItems)
+	for i := 0; i < numItems; i++ {
+		points[i] = newPoint(i/1000, i%1000)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewWithOptions(2, Options{}, points...)
+	}
+}
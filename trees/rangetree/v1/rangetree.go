@@ -1,22 +1,97 @@
 package v1
 
 import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+
 	r "github.com/dzyp/data/trees/rangetree"
 )
 
-var (
-	REBALANCE_RATIO float64 = .3 // performance tuning will be required to change this
-	// .5 would be perfectly balanced
+const (
+	/*
+		A node is rebuilt when either child holds less than this share of
+		its leaves.  .5 would be perfectly balanced, performance tuning
+		will be required to change this.
+	*/
+	DefaultBalance float64 = .3
+	/*
+		Building or inserting a subtree of at least this many entries
+		hands one half to another goroutine.
+	*/
+	DefaultParallelThreshold = 1 << 13
 )
 
+/*
+Options tunes a tree, the zero value selects every default.  Nested trees
+for later dimensions share their parent's options.
+*/
+type Options struct {
+	/*
+		The weight balance every node is kept to, between 0 and 1/3, the
+		constructors return ErrInvalidBalance otherwise.  Zero selects
+		DefaultBalance.  A node is rebuilt when one of its children
+		holds less than this share of its leaves, so rebuilds are amortized
+		across the inserts and removes that unbalanced it.
+	*/
+	Balance float64
+	/*
+		What to do with entries that share every coordinate, Replace by
+		default.  Remove and Contains match the exact entry given in every
+		mode, see rangetree.SameEntry.
+	*/
+	Duplicates r.DuplicateMode
+	/*
+		Subtrees built or inserted into with at least this many entries
+		are split across goroutines, at most GOMAXPROCS of them.  Zero
+		selects DefaultParallelThreshold, a negative value keeps all of
+		the work on the calling goroutine.  The tree is the same either
+		way.
+	*/
+	ParallelThreshold int
+	/*
+		When set every node of the last dimension keeps the aggregate of
+		the entries below it so Aggregate can combine whole subtrees
+		covered by a query.
+	*/
+	Aggregator *Aggregator
+}
+
+/*
+Returned by the constructors when Options.Balance is outside [0, 1/3],
+match it with errors.Is.  Above 1/3 a node of three leaves can never be
+balanced, so every write would rebuild.
+*/
+var ErrInvalidBalance = errors.New(`rangetree: balance must be between 0 and 1/3`)
+
+func (self *Options) validate() error {
+	if self.Balance < 0 || self.Balance > 1./3 {
+		return fmt.Errorf(`%w: %v`, ErrInvalidBalance, self.Balance)
+	}
+
+	return nil
+}
+
+func (self *Options) balance() float64 {
+	if self.Balance <= 0 {
+		return DefaultBalance
+	}
+
+	return self.Balance
+}
+
 type node struct {
-	left        *node
-	right       *node
-	parent      *node
-	entry       r.Entry
-	value       int
-	numChildren int
-	rt          *tree
+	left          *node
+	right         *node
+	parent        *node
+	entry         r.Entry
+	duplicates    []r.Entry // entries after the first at a multiset leaf
+	aggregate     any       // of every entry below, kept in the last dimension
+	value         int
+	numChildren   int
+	numDuplicates int // held by the multiset leaves below, kept by refresh
+	rt            *tree
 }
 
 func newNode(tree *tree, entries *entriesWrapper) *node {
@@ -25,17 +100,14 @@ func newNode(tree *tree, entries *entriesWrapper) *node {
 	}
 
 	if tree.isLastDimension() && entries.isLastValue() {
-		entry := entries.lastValue()
-		return &node{
-			entry: entry,
-			value: entry.GetDimensionalValue(tree.dimension),
-		}
+		return tree.newLeaf(entries.entries)
 	}
 
 	if entries.isLastValue() { // we need to add another tree
 		return &node{
 			value: entries.median(),
-			rt: new(
+			rt: newTree(
+				tree.options,
 				tree.maxDimensions,
 				tree.dimension+1,
 				entries.getEntriesAtValue(entries.median())...,
@@ -44,27 +116,127 @@ func newNode(tree *tree, entries *entriesWrapper) *node {
 	}
 	left, right := entries.split(-1)
 
-	n := &node{
-		left:        newNode(tree, left),
-		right:       newNode(tree, right),
-		value:       entries.median(),
-		numChildren: entries.len(),
+	n := &node{value: entries.median()}
+
+	var leftN, rightN *node
+	tree.fork(len(entries.entries), func() {
+		leftN = newNode(tree, left)
+	}, func() {
+		rightN = newNode(tree, right)
+	})
+	n.setChildren(tree, leftN, rightN)
+
+	return n
+}
+
+/*
+builds a balanced node over entries that are already sorted on every
+dimension from the tree's dimension on.  values holds the distinct keys in
+this dimension and starts the index of the first entry at each key, with
+one extra trailing index.  This does not sort or copy so it is linear in
+the number of entries.
+*/
+func newSortedNode(tree *tree, entries []r.Entry, values, starts []int) *node {
+	if len(values) == 0 {
+		return nil
+	}
+
+	if len(values) == 1 {
+		if tree.isLastDimension() {
+			return tree.newLeaf(entries[starts[0]:starts[1]])
+		}
+
+		return &node{
+			value: values[0],
+			rt: newSorted(
+				tree.options,
+				tree.maxDimensions,
+				tree.dimension+1,
+				entries[starts[0]:starts[1]],
+			),
+		}
 	}
 
-	n.left.parent = n
-	n.right.parent = n
+	median := len(values) / 2
 
+	n := &node{value: values[median]}
+	var left, right *node
+	tree.fork(starts[len(starts)-1]-starts[0], func() {
+		left = newSortedNode(tree, entries, values[0:median], starts[0:median+1])
+	}, func() {
+		right = newSortedNode(tree, entries, values[median:], starts[median:])
+	})
+	n.setChildren(tree, left, right)
+
+	return n
+}
+
+/*
+returns a last dimension leaf for entries that share every coordinate,
+keeping the ones the tree's duplicate mode asks for
+*/
+func (self *tree) newLeaf(entries []r.Entry) *node {
+	n := &node{value: entries[0].GetDimensionalValue(self.dimension)}
+
+	switch self.options.Duplicates {
+	case r.Set:
+		n.entry = entries[0]
+	case r.Multiset:
+		n.entry = entries[0]
+		n.duplicates = slices.Clone(entries[1:])
+	default:
+		n.entry = entries[len(entries)-1]
+	}
+
+	n.refresh(self)
 	return n
 }
 
+/*
+merges entries sharing this last dimension leaf's coordinates into it,
+returns the number of entries added
+*/
+func (self *node) merge(tree *tree, entries []r.Entry) int {
+	switch tree.options.Duplicates {
+	case r.Set:
+		return 0
+	case r.Multiset:
+		self.duplicates = append(self.duplicates, entries...)
+		self.refresh(tree)
+		return len(entries)
+	}
+
+	self.entry = entries[len(entries)-1]
+	self.refresh(tree)
+	return 0
+}
+
+/*
+visits the entries held by a last dimension leaf
+*/
+func (self *node) visit(fn func(r.Entry) bool) bool {
+	if !fn(self.entry) {
+		return false
+	}
+
+	for _, entry := range self.duplicates {
+		if !fn(entry) {
+			return false
+		}
+	}
+
+	return true
+}
+
 type queryResult struct {
 	entries []r.Entry
 	index   int
 }
 
-func (self *queryResult) addEntry(entry r.Entry) {
+func (self *queryResult) addEntry(entry r.Entry) bool {
 	self.entries[self.index] = entry
 	self.index++
+	return true
 }
 
 func (self *queryResult) results() []r.Entry {
@@ -85,16 +257,17 @@ func (self *node) isLastDimension() bool {
 	return self.rt == nil
 }
 
-func (self *node) needsRebalancing() bool {
+func (self *node) needsRebalancing(tree *tree) bool {
 	if self.isLeaf() {
 		return false
 	}
 
-	total := float64(self.left.numChildren + self.right.numChildren)
+	total := float64(self.left.size() + self.right.size())
+	ratio := tree.options.balance()
 
-	if float64(self.left.numChildren)/total < REBALANCE_RATIO {
+	if float64(self.left.size())/total < ratio {
 		return true
-	} else if float64(self.right.numChildren)/total < REBALANCE_RATIO {
+	} else if float64(self.right.size())/total < ratio {
 		return true
 	}
 
@@ -113,57 +286,215 @@ func (self *node) sibling() *node {
 	}
 }
 
-func (self *node) all(results *queryResult) {
+/*
+visits every entry below this node, returns false if fn asked to stop
+*/
+func (self *node) all(fn func(r.Entry) bool) bool {
 	if self.isLeaf() {
 		if self.isLastDimension() {
-			results.addEntry(self.entry)
-		} else {
-			self.rt.all(results)
+			return self.visit(fn)
 		}
 
-		return
+		return self.rt.all(fn)
 	}
 
-	self.left.all(results)
-	self.right.all(results)
+	return self.left.all(fn) && self.right.all(fn)
 }
 
-func (self *node) getRange(query r.Query, dimension int, results *queryResult, left, right bool) {
-	bounds := query.GetDimensionalBounds(dimension)
+/*
+visits every entry below this node that falls within the query, returns
+false if fn asked to stop
+*/
+func (self *node) getRange(query r.Query, dimension int, fn func(r.Entry) bool, left, right bool) bool {
+	low, high := r.Inclusive(query.GetDimensionalBounds(dimension))
 	if self.isLeaf() {
-		if self.value >= bounds.Low() && self.value < bounds.High() {
+		if self.value >= low && self.value <= high {
 			if self.rt == nil { // i am a true leaf, last dimension
-				results.addEntry(self.entry)
-				return
+				return self.visit(fn)
 			} else { // i am not the last dimension
-				self.rt.getRange(query, results)
-				return
+				return self.rt.getRange(query, fn)
 			}
 		} else { // we should hopefully not get here
-			return
+			return true
 		}
 	}
 
-	if bounds.High() <= self.value {
-		self.left.getRange(query, dimension, results, left, right) //left right should be false here
-		return
+	if high < self.value {
+		return self.left.getRange(query, dimension, fn, left, right) //left right should be false here
 	}
 
-	if bounds.Low() > self.value {
-		self.right.getRange(query, dimension, results, left, right) //left right should be false here
-		return
+	if low > self.value {
+		return self.right.getRange(query, dimension, fn, left, right) //left right should be false here
 	}
 
-	if bounds.Low() <= self.value && left { // we can safely grab all of right here
-		self.left.getRange(query, dimension, results, true, false)
-		self.right.flatten(query, dimension, results)
-	} else if bounds.High() > self.value && right {
-		self.left.flatten(query, dimension, results)
-		self.right.getRange(query, dimension, results, false, true)
-	} else {
-		self.left.getRange(query, dimension, results, true, false)
-		self.right.getRange(query, dimension, results, false, true)
+	if low <= self.value && left { // we can safely grab all of right here
+		return self.left.getRange(query, dimension, fn, true, false) &&
+			self.right.flatten(query, dimension, fn)
+	} else if high >= self.value && right {
+		return self.left.flatten(query, dimension, fn) &&
+			self.right.getRange(query, dimension, fn, false, true)
+	}
+
+	return self.left.getRange(query, dimension, fn, true, false) &&
+		self.right.getRange(query, dimension, fn, false, true)
+}
+
+/*
+counts the entries below this node that fall within the query.  In the
+last dimension a subtree that is entirely covered by the query contributes
+its numChildren without being walked.
+*/
+func (self *node) count(tree *tree, query r.Query, left, right bool) int {
+	low, high := r.Inclusive(query.GetDimensionalBounds(tree.dimension))
+	if self.isLeaf() {
+		if self.value < low || self.value > high {
+			return 0
+		}
+
+		if self.rt == nil {
+			return self.weight()
+		}
+
+		return self.rt.count(query)
+	}
+
+	if high < self.value {
+		return self.left.count(tree, query, left, right)
+	}
+
+	if low > self.value {
+		return self.right.count(tree, query, left, right)
+	}
+
+	if left {
+		return self.left.count(tree, query, true, false) +
+			self.right.countCovered(tree, query)
+	} else if right {
+		return self.left.countCovered(tree, query) +
+			self.right.count(tree, query, false, true)
+	}
+
+	return self.left.count(tree, query, true, false) +
+		self.right.count(tree, query, false, true)
+}
+
+/*
+counts the entries below a node whose values all fall within the query in
+this dimension, the counterpart of flatten.  Only the last dimension can
+use the size of the node, earlier ones visit every leaf below it.
+*/
+func (self *node) countCovered(tree *tree, query r.Query) int {
+	if tree.isLastDimension() {
+		return self.weight()
+	}
+
+	if self.isLeaf() {
+		return self.rt.count(query)
+	}
+
+	return self.left.countCovered(tree, query) +
+		self.right.countCovered(tree, query)
+}
+
+/*
+removes the entries below this node that fall within the query.  Returns
+the node that takes this one's place, nil if nothing is left, and the
+number of entries removed.  The left and right flags mean the same as they
+do for getRange.
+*/
+func (self *node) removeRange(tree *tree, query r.Query, left, right bool) (*node, int) {
+	low, high := r.Inclusive(query.GetDimensionalBounds(tree.dimension))
+	if self.isLeaf() {
+		if self.value < low || self.value > high {
+			return self, 0
+		}
+
+		return self.removeCovered(tree, query)
+	}
+
+	lowN, highN := self.left, self.right
+	var lowRemoved, highRemoved int
+
+	switch {
+	case high < self.value:
+		lowN, lowRemoved = self.left.removeRange(tree, query, left, right)
+	case low > self.value:
+		highN, highRemoved = self.right.removeRange(tree, query, left, right)
+	case left:
+		lowN, lowRemoved = self.left.removeRange(tree, query, true, false)
+		highN, highRemoved = self.right.removeCovered(tree, query)
+	case right:
+		lowN, lowRemoved = self.left.removeCovered(tree, query)
+		highN, highRemoved = self.right.removeRange(tree, query, false, true)
+	default:
+		lowN, lowRemoved = self.left.removeRange(tree, query, true, false)
+		highN, highRemoved = self.right.removeRange(tree, query, false, true)
 	}
+
+	return self.join(tree, lowN, highN), lowRemoved + highRemoved
+}
+
+/*
+removeRange for a node whose values all fall within the query in this
+dimension.  In the last dimension the whole subtree is dropped at once.
+*/
+func (self *node) removeCovered(tree *tree, query r.Query) (*node, int) {
+	if tree.isLastDimension() {
+		return nil, self.weight()
+	}
+
+	if self.isLeaf() {
+		removed := self.rt.removeRange(query)
+		if self.rt.root == nil {
+			return nil, removed
+		}
+
+		return self, removed
+	}
+
+	lowN, lowRemoved := self.left.removeCovered(tree, query)
+	highN, highRemoved := self.right.removeCovered(tree, query)
+
+	return self.join(tree, lowN, highN), lowRemoved + highRemoved
+}
+
+/*
+makes what is left of this node's children its children again, returns
+the node that takes this node's place, a lone child is spliced up
+*/
+func (self *node) join(tree *tree, left, right *node) *node {
+	if left == nil {
+		return right
+	}
+
+	if right == nil {
+		return left
+	}
+
+	self.setChildren(tree, left, right)
+	self.checkBalance(tree)
+	return self
+}
+
+/*
+descends from this node to the leaf holding value, returns nil if there
+isn't one
+*/
+func (self *node) find(value int) *node {
+	n := self
+	for !n.isLeaf() {
+		if value >= n.value {
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	if n.value != value {
+		return nil
+	}
+
+	return n
 }
 
 func (self *node) grandParent() *node {
@@ -174,18 +505,17 @@ func (self *node) grandParent() *node {
 	return self.parent.parent
 }
 
-func (self *node) flatten(query r.Query, dimension int, results *queryResult) {
+func (self *node) flatten(query r.Query, dimension int, fn func(r.Entry) bool) bool {
 	if self.isLeaf() {
 		if self.rt == nil { // i am a true leaf
-			results.addEntry(self.entry)
-		} else {
-			self.rt.getRange(query, results)
+			return self.visit(fn)
 		}
-		return
+
+		return self.rt.getRange(query, fn)
 	}
 
-	self.left.flatten(query, dimension, results)
-	self.right.flatten(query, dimension, results)
+	return self.left.flatten(query, dimension, fn) &&
+		self.right.flatten(query, dimension, fn)
 }
 
 func (self *node) rebalance(tree *tree) {
@@ -198,25 +528,8 @@ func (self *node) rebalance(tree *tree) {
 		}
 	}
 
-	if self.needsRebalancing() {
-		results := newResult(tree.numChildren)
-		self.left.all(results)
-		self.right.all(results)
-
-		entries := results.results()
-
-		n := newNode(tree, newEntries(entries, tree.dimension, false))
-		n.parent = self.parent
-		if self.isRoot() {
-			tree.root = n
-		} else {
-			if self.isLeft() {
-				self.parent.left = n
-			} else {
-				self.parent.right = n
-			}
-		}
-
+	if self.needsRebalancing(tree) {
+		self.rebuild(tree)
 		return // we don't need to rebalance our children now
 	} else {
 		self.left.rebalance(tree)
@@ -225,110 +538,212 @@ func (self *node) rebalance(tree *tree) {
 }
 
 /*
-returns the inserted entry, returns nil if nothing was inserted
+rebalances this node after its children changed, only this node is
+checked as its children were checked on the way back up
 */
-func (self *node) insert(tree *tree, entries *entriesWrapper) {
-	if len(entries.entries) == 0 {
+func (self *node) checkBalance(tree *tree) {
+	if self.needsRebalancing(tree) {
+		self.rebuild(tree)
+	}
+}
+
+/*
+rebuilds the subtree below this node into a perfectly balanced one in
+place.  Only this dimension is rebuilt, the leaves and the trees they hold
+for later dimensions are reused as they are.
+*/
+func (self *node) rebuild(tree *tree) {
+	leaves := make([]*node, 0, self.numChildren)
+	self.leaves(func(leaf *node) {
+		leaves = append(leaves, leaf)
+	})
+
+	n := buildFromLeaves(tree, leaves)
+	self.setChildren(tree, n.left, n.right)
+	self.value = n.value
+}
+
+func (self *node) leaves(fn func(*node)) {
+	if self.isLeaf() {
+		fn(self)
 		return
 	}
 
+	self.left.leaves(fn)
+	self.right.leaves(fn)
+}
+
+/*
+builds a balanced subtree over leaves already in order, splitting them
+the same way newNode splits a sorted set of values
+*/
+func buildFromLeaves(tree *tree, leaves []*node) *node {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+
+	median := len(leaves) / 2
+
+	n := &node{value: leaves[median].value}
+	n.setChildren(
+		tree, buildFromLeaves(tree, leaves[0:median]), buildFromLeaves(tree, leaves[median:]),
+	)
+
+	return n
+}
+
+/*
+returns true if this node has been spliced out of the tree
+*/
+func (self *node) detached(tree *tree) bool {
+	if self.isRoot() {
+		return tree.root != self
+	}
+
+	return !self.isLeft() && !self.isRight()
+}
+
+/*
+returns the number of leaves this node contributes to its parent's
+numChildren, which is what balance is weighed by.  A multiset leaf counts
+as one however many entries it holds, no split could even out a heavy
+leaf.
+*/
+func (self *node) size() int {
 	if self.isLeaf() {
-		median := entries.median()
+		return 1
+	}
 
-		if median == self.value && len(entries.sortedDimensionalValues) == 1 && !tree.isLastDimension() {
-			self.rt.insert(entries.getEntriesAtValue(self.value)...)
-		} else if median == self.value { // we now go to the right
-			if !tree.isLastDimension() {
-				self.rt.insert(entries.getEntriesAtValue(self.value)...) // insert entries
-			}
+	return self.numChildren
+}
 
-			left, right := entries.split(-1)
+func (self *node) duplicatesBelow() int {
+	if self.isLeaf() {
+		return len(self.duplicates)
+	}
 
-			leftN := newNode(tree, left)
-			if leftN == nil { // no values left, we need to take the new value
-				if tree.isLastDimension() {
-					self.entry = entries.lastValue()
-				} else {
-					self.rt.insert(entries.getEntriesAtValue(self.value)...)
-				}
+	return self.numDuplicates
+}
 
-				return
-			}
-			leftN.parent = self
-			self.left = leftN
+/*
+returns the number of entries below a last dimension node, its leaves
+along with the duplicates they hold
+*/
+func (self *node) weight() int {
+	return self.size() + self.duplicatesBelow()
+}
 
-			rightN := &node{
-				value:  self.value,
-				rt:     self.rt,
-				parent: self,
-			}
+/*
+returns the number of entries held below this node, across all dimensions
+*/
+func (self *node) numEntries() int {
+	if self.isLeaf() {
+		if self.isLastDimension() {
+			return self.weight()
+		}
 
-			rightN.entry = self.entry
-			self.entry = nil
-
-			self.right = rightN
-			self.rt = nil
-			self.right.insert(tree, right)
-			self.numChildren = 2
-		} else if median > self.value {
-			leftN := &node{
-				value:  self.value,
-				rt:     self.rt,
-				parent: self,
-				entry:  self.entry,
-			}
+		return self.rt.numChildren
+	}
 
-			self.entry = nil
+	return self.left.numEntries() + self.right.numEntries()
+}
 
-			self.left = leftN
-			self.rt = nil
-			self.value = median
+/*
+inserts the entries below this node, returns the number of leaves added
+to this dimension and the number of entries added overall.  Entries that
+replace an existing entry are not counted.
+*/
+func (self *node) insert(tree *tree, entries *entriesWrapper) (int, int) {
+	if entries.len() == 0 {
+		return 0, 0
+	}
 
-			left, right := entries.split(-1)
+	if !self.isLeaf() {
+		left, right := entries.split(entries.find(self.value))
 
-			rightN := newNode(tree, right)
-			rightN.parent = self
-			self.right = rightN
-			self.left.insert(tree, left)
-			self.numChildren = 2
-		} else if median < self.value {
-			rightN := &node{
-				value:  self.value,
-				rt:     self.rt,
-				parent: self,
-			}
+		var leftLeaves, leftEntries, rightLeaves, rightEntries int
+		tree.fork(len(entries.entries), func() {
+			leftLeaves, leftEntries = self.left.insert(tree, left)
+		}, func() {
+			rightLeaves, rightEntries = self.right.insert(tree, right)
+		})
 
-			rightN.entry = self.entry
-			self.entry = nil
+		self.numChildren += leftLeaves + rightLeaves
+		self.refresh(tree)
+		self.checkBalance(tree)
 
-			left, right := entries.split(
-				len(entries.sortedDimensionalValues)/2 + 1,
-			)
+		return leftLeaves + rightLeaves, leftEntries + rightEntries
+	}
+
+	// divide the new entries into those below, at and above this leaf
+	low, rest := entries.split(entries.find(self.value))
+	high := rest
+	added := 0
+
+	if rest.len() > 0 && rest.getSortedValues()[0] == self.value {
+		var at *entriesWrapper
+		at, high = rest.split(1)
 
-			self.right = rightN
-			self.rt = nil
-			leftN := newNode(tree, left)
-			self.left = leftN
-			leftN.parent = self
-			self.right.insert(tree, right)
-			self.numChildren = 2
+		if tree.isLastDimension() {
+			added = self.merge(tree, at.entries)
+		} else {
+			added += self.rt.insert(at.entries...)
 		}
+	}
 
-		return
+	lowN, highN := newNode(tree, low), newNode(tree, high)
+	if lowN == nil && highN == nil {
+		return 0, added
 	}
 
-	index := entries.find(self.value)
+	// this leaf becomes an internal node and moves itself down a level
+	leaf := &node{
+		value:      self.value,
+		entry:      self.entry,
+		duplicates: self.duplicates,
+		aggregate:  self.aggregate,
+		rt:         self.rt,
+	}
+
+	self.entry = nil
+	self.duplicates = nil
+	self.rt = nil
+
+	leaves := 0
+	switch {
+	case highN == nil:
+		self.setChildren(tree, lowN, leaf)
+		leaves, added = lowN.size(), added+lowN.numEntries()
+	case lowN == nil:
+		self.value = high.getSortedValues()[0]
+		self.setChildren(tree, leaf, highN)
+		leaves, added = highN.size(), added+highN.numEntries()
+	default:
+		right := &node{value: high.getSortedValues()[0]}
+		right.setChildren(tree, leaf, highN)
+		self.setChildren(tree, lowN, right)
+		leaves = lowN.size() + highN.size()
+		added += lowN.numEntries() + highN.numEntries()
+	}
 
-	left, right := entries.split(index)
+	return leaves, added
+}
 
-	self.left.insert(tree, left)
-	self.right.insert(tree, right)
+func (self *node) setChildren(tree *tree, left, right *node) {
+	self.left, self.right = left, right
+	left.parent, right.parent = self, self
+	self.numChildren = left.size() + right.size()
+	self.refresh(tree)
 }
 
 func (self *node) copy() *node {
 	newNode := &node{
-		numChildren: self.numChildren,
-		value:       self.value,
+		numChildren:   self.numChildren,
+		numDuplicates: self.numDuplicates,
+		value:         self.value,
+		entry:         self.entry,
+		duplicates:    slices.Clone(self.duplicates),
+		aggregate:     self.aggregate,
 	}
 
 	if self.rt != nil {
@@ -366,6 +781,36 @@ func (self *node) isLeft() bool {
 	return self.parent.left == self
 }
 
+/*
+removes exactly the given entry from a last dimension leaf, a multiset
+leaf itself is only removed with its last entry.  The bool is true if the
+leaf was.
+*/
+func (self *node) removeInstance(tree *tree, entry r.Entry) (r.Entry, bool) {
+	if r.SameEntry(self.entry, entry) {
+		removed := self.entry
+		if len(self.duplicates) == 0 {
+			self.removeSelf(tree)
+			return removed, true
+		}
+
+		self.entry = self.duplicates[0]
+		self.duplicates = slices.Delete(self.duplicates, 0, 1)
+		self.refresh(tree)
+		return removed, false
+	}
+
+	for i, duplicate := range self.duplicates {
+		if r.SameEntry(duplicate, entry) {
+			self.duplicates = slices.Delete(self.duplicates, i, i+1)
+			self.refresh(tree)
+			return duplicate, false
+		}
+	}
+
+	return nil, false
+}
+
 func (self *node) removeSelf(tree *tree) {
 	if self.isRoot() { // we are the root
 		tree.root = nil
@@ -390,43 +835,53 @@ func (self *node) removeSelf(tree *tree) {
 }
 
 /*
-Returns nil if entry wasn't found
+Returns nil if entry wasn't found, the bool is true if this node's size
+shrank, which is when a leaf was removed from this dimension
 */
-func (self *node) remove(tree *tree, entry r.Entry) r.Entry {
+func (self *node) remove(tree *tree, entry r.Entry) (r.Entry, bool) {
 	if self.isLeaf() {
-		if self.value == entry.GetDimensionalValue(tree.dimension) {
-			if self.rt == nil { // we are the last dimension
-				self.removeSelf(tree)
-
-				return entry
-			} else {
-				entry = self.rt.remove(entry)
-				if entry == nil { // nothing was removed
-					return entry
-				}
-
-				if self.rt.numChildren == 0 {
-					self.removeSelf(tree)
-				}
-
-				return entry
-			}
-		} else {
-			return nil
+		if self.value != entry.GetDimensionalValue(tree.dimension) {
+			return nil, false
+		}
+
+		if self.rt == nil { // we are the last dimension
+			return self.removeInstance(tree, entry)
+		}
+
+		entry = self.rt.remove(entry)
+		if entry == nil { // nothing was removed
+			return nil, false
 		}
+
+		if self.rt.numChildren == 0 {
+			self.removeSelf(tree)
+			return entry, true
+		}
+
+		return entry, false
 	}
 
+	var removedLeaf bool
 	if entry.GetDimensionalValue(tree.dimension) >= self.value {
-		entry = self.right.remove(tree, entry)
+		entry, removedLeaf = self.right.remove(tree, entry)
 	} else {
-		entry = self.left.remove(tree, entry)
+		entry, removedLeaf = self.left.remove(tree, entry)
 	}
 
-	if entry != nil {
+	if removedLeaf {
 		self.numChildren--
 	}
 
-	return entry
+	// a duplicate taken from a multiset leaf changes the counts, not the
+	// shape
+	if entry != nil && !self.detached(tree) {
+		self.refresh(tree)
+		if removedLeaf {
+			self.checkBalance(tree)
+		}
+	}
+
+	return entry, removedLeaf
 }
 
 type tree struct {
@@ -434,6 +889,7 @@ type tree struct {
 	dimension     int
 	maxDimensions int
 	numChildren   int
+	options       *Options
 }
 
 func (self *tree) remove(entry r.Entry) r.Entry {
@@ -441,7 +897,7 @@ func (self *tree) remove(entry r.Entry) r.Entry {
 		return nil
 	}
 
-	entry = self.root.remove(self, entry)
+	entry, _ = self.root.remove(self, entry)
 	if entry != nil {
 		self.numChildren--
 	}
@@ -461,75 +917,303 @@ func (self *tree) isLastDimension() bool {
 	return self.dimension >= self.maxDimensions
 }
 
-func (self *tree) all(results *queryResult) {
+func (self *tree) all(fn func(r.Entry) bool) bool {
 	if self.root == nil {
-		return
+		return true
 	}
 
-	self.root.all(results)
+	return self.root.all(fn)
 }
 
 func (self *tree) All() []r.Entry {
 	results := newResult(self.numChildren)
-	self.all(results)
+	self.all(results.addEntry)
 
 	return results.entries[0:results.index]
 }
 
 func (self *tree) Remove(entries ...r.Entry) {
+	if err := self.RemoveChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *tree) RemoveChecked(entries ...r.Entry) error {
+	if err := r.ValidateEntries(self.maxDimensions, entries...); err != nil {
+		return err
+	}
+
 	for _, entry := range entries {
 		self.remove(entry)
 	}
+
+	return nil
 }
 
 func (self *tree) Len() int {
 	return self.numChildren
 }
 
-func (self *tree) getRange(query r.Query, results *queryResult) {
+func (self *tree) getRange(query r.Query, fn func(r.Entry) bool) bool {
 	if self.root == nil {
-		return
+		return true
 	}
 
-	self.root.getRange(query, self.dimension, results, false, false)
+	return self.root.getRange(query, self.dimension, fn, false, false)
 }
 
 func (self *tree) GetRange(query r.Query) []r.Entry {
+	entries := []r.Entry{}
+
+	self.getRange(query, func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+func (self *tree) Range(query r.Query, fn func(r.Entry) bool) {
+	self.getRange(query, fn)
+}
+
+func (self *tree) Iter(query r.Query) iter.Seq[r.Entry] {
+	return func(yield func(r.Entry) bool) {
+		self.getRange(query, yield)
+	}
+}
+
+/*
+anything that can give its value in a dimension, an entry or a set of
+coordinates
+*/
+type valuer interface {
+	GetDimensionalValue(dimension int) int
+}
+
+/*
+returns the last dimension leaf at the given coordinates, nil if there is
+none
+*/
+func (self *tree) find(point valuer) *node {
 	if self.root == nil {
-		return []r.Entry{}
+		return nil
 	}
 
-	results := newResult(self.numChildren)
+	n := self.root.find(point.GetDimensionalValue(self.dimension))
+	if n == nil || n.rt == nil {
+		return n
+	}
 
-	self.getRange(query, results)
-	return results.entries[0:results.index]
+	return n.rt.find(point)
 }
 
-func (self *tree) insert(entries ...r.Entry) r.Entry {
+/*
+find for raw coordinates, converting them to a valuer would allocate
+*/
+func (self *tree) findValues(values []int) *node {
+	if self.root == nil {
+		return nil
+	}
+
+	n := self.root.find(values[self.dimension-1])
+	if n == nil || n.rt == nil {
+		return n
+	}
+
+	return n.rt.findValues(values)
+}
+
+/*
+Only the returned slice is allocated, a miss allocates nothing.
+*/
+func (self *tree) Get(values ...int) []r.Entry {
+	if len(values) != self.maxDimensions {
+		return nil
+	}
+
+	n := self.findValues(values)
+	if n == nil {
+		return nil
+	}
+
+	if len(n.duplicates) == 0 {
+		return []r.Entry{n.entry}
+	}
+
+	return append([]r.Entry{n.entry}, n.duplicates...)
+}
+
+func (self *tree) Contains(entry r.Entry) bool {
+	if r.ValidateEntries(self.maxDimensions, entry) != nil {
+		return false
+	}
+
+	n := self.find(entry)
+	if n == nil {
+		return false
+	}
+
+	return !n.visit(func(e r.Entry) bool {
+		return !r.SameEntry(e, entry)
+	})
+}
+
+func (self *tree) count(query r.Query) int {
+	if self.root == nil {
+		return 0
+	}
+
+	return self.root.count(self, query, false, false)
+}
+
+/*
+Counts within the last dimension from subtree sizes alone, a subtree the
+query covers adds its numChildren without being walked.  Earlier
+dimensions keep no counts across their nested trees, so a covered subtree
+there still counts the nested tree of each of its leaves.  In one
+dimension this is O(log n), beyond that it grows with the number of
+distinct values the query covers in the dimensions before the last, each
+costing a search of a nested tree, rather than with the number of entries
+counted.
+*/
+func (self *tree) Count(query r.Query) int {
+	return self.count(query)
+}
+
+/*
+returns the number of entries removed
+*/
+func (self *tree) removeRange(query r.Query) int {
+	if self.root == nil {
+		return 0
+	}
+
+	root, removed := self.root.removeRange(self, query, false, false)
+	if root != nil {
+		root.parent = nil
+	}
+
+	self.root = root
+	self.numChildren -= removed
+	return removed
+}
+
+/*
+Covered subtrees are cut out whole rather than entry by entry, and the
+counts of the nodes above them are fixed on the way back up.
+*/
+func (self *tree) RemoveRange(query r.Query) int {
+	return self.removeRange(query)
+}
+
+/*
+returns the number of entries added, replaced or ignored duplicates are not
+counted
+*/
+func (self *tree) insert(entries ...r.Entry) int {
 	ew := newEntries(entries, self.dimension, false)
 	if self.root == nil {
 		self.root = newNode(self, ew)
-		self.numChildren += len(entries)
-		return nil
+		if self.root == nil {
+			return 0
+		}
+
+		added := self.root.numEntries()
+		self.numChildren += added
+		return added
 	}
 
-	self.root.insert(self, ew)
+	_, added := self.root.insert(self, ew)
+	self.numChildren += added
+
+	return added
+}
+
+func (self *tree) Insert(values ...r.Entry) {
+	if err := self.InsertChecked(values...); err != nil {
+		panic(err)
+	}
+}
 
-	self.numChildren += len(entries)
+/*
+Entries are sorted on every dimension so the nested trees can take their
+share of them without sorting again, any entry whose Less disagrees with
+its dimensional values is caught here rather than deep in a split.
+*/
+func (self *tree) InsertChecked(values ...r.Entry) error {
+	sorted, err := sortEntries(self.maxDimensions, values)
+	if err != nil {
+		return err
+	}
 
+	self.insert(sorted...)
 	return nil
 }
 
-func (self *tree) Insert(values ...r.Entry) {
-	byDimension(self.dimension).Sort(values)
+/*
+replaces old with entry, descending through the dimensions both share so
+only the nested tree where they first differ is restructured.  Returns
+whether old was found and the change in the number of entries.
+*/
+func (self *tree) update(old, entry r.Entry) (bool, int) {
+	value := old.GetDimensionalValue(self.dimension)
+	if self.isLastDimension() || value != entry.GetDimensionalValue(self.dimension) {
+		if self.remove(old) == nil {
+			return false, 0
+		}
+
+		return true, self.insert(entry) - 1
+	}
 
-	self.insert(values...)
+	if self.root == nil {
+		return false, 0
+	}
+
+	n := self.root.find(value)
+	if n == nil {
+		return false, 0
+	}
+
+	found, delta := n.rt.update(old, entry)
+	self.numChildren += delta
+	return found, delta
+}
+
+func (self *tree) Update(old, entry r.Entry) bool {
+	if err := r.ValidateEntries(self.maxDimensions, old, entry); err != nil {
+		panic(err)
+	}
+
+	found, _ := self.update(old, entry)
+	return found
+}
+
+/*
+validates entries and returns a copy sorted on every dimension, the
+caller's slice is left in its order whether or not they are valid
+*/
+func sortEntries(maxDimensions int, entries []r.Entry) ([]r.Entry, error) {
+	if err := r.ValidateEntries(maxDimensions, entries...); err != nil {
+		return nil, err
+	}
+
+	sorted := slices.Clone(entries)
+	byDimension(maxDimensions).Sort(sorted)
+
+	if err := r.ValidateOrder(maxDimensions, sorted); err != nil {
+		return nil, err
+	}
+
+	return sorted, nil
 }
 
 func (self *tree) copy() *tree {
 	cp := &tree{
 		dimension:     self.dimension,
 		maxDimensions: self.maxDimensions,
+		numChildren:   self.numChildren,
+		options:       self.options,
 	}
 
 	if self.root == nil {
@@ -546,20 +1230,84 @@ func (self *tree) Copy() r.RangeTree {
 
 func (self *tree) Clear() {
 	self.root = nil
+	self.numChildren = 0
 }
 
 func new(maxDimensions, dimension int, entries ...r.Entry) *tree {
+	return newTree(&Options{}, maxDimensions, dimension, entries...)
+}
+
+func newTree(options *Options, maxDimensions, dimension int, entries ...r.Entry) *tree {
 	t := &tree{
 		maxDimensions: maxDimensions,
 		dimension:     dimension,
-		numChildren:   len(entries),
+		options:       options,
 	}
 
 	t.root = newNode(t, newEntries(entries, dimension, false))
+	if t.root != nil {
+		t.numChildren = t.root.numEntries()
+	}
+
+	return t
+}
+
+/*
+builds a tree from entries already sorted on every dimension from this
+dimension on
+*/
+func newSorted(options *Options, maxDimensions, dimension int, entries []r.Entry) *tree {
+	t := &tree{
+		maxDimensions: maxDimensions,
+		dimension:     dimension,
+		options:       options,
+	}
+
+	values := make([]int, 0)
+	starts := make([]int, 0)
+	for i, entry := range entries {
+		value := entry.GetDimensionalValue(dimension)
+		if i == 0 || value != values[len(values)-1] {
+			values = append(values, value)
+			starts = append(starts, i)
+		}
+	}
+	starts = append(starts, len(entries))
+
+	t.root = newSortedNode(t, entries, values, starts)
+	if t.root != nil {
+		t.numChildren = t.root.numEntries()
+	}
+
 	return t
 }
 
 func New(maxDimensions int, entries ...r.Entry) *tree {
-	byDimension(1).Sort(entries)
-	return new(maxDimensions, 1, entries...)
+	return NewWithOptions(maxDimensions, Options{}, entries...)
+}
+
+func NewWithOptions(maxDimensions int, options Options, entries ...r.Entry) *tree {
+	t, err := NewChecked(maxDimensions, options, entries...)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+/*
+Builds a tree like NewWithOptions, returning an error instead of panicking
+when an entry or the options are invalid.
+*/
+func NewChecked(maxDimensions int, options Options, entries ...r.Entry) (*tree, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	sorted, err := sortEntries(maxDimensions, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTree(&options, maxDimensions, 1, sorted...), nil
 }
@@ -1,12 +1,17 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"runtime"
 	"testing"
 	"time"
 
 	r "github.com/dzyp/data/trees/rangetree"
+	"github.com/dzyp/data/trees/rangetree/rangetreetest"
 )
 
 type point struct {
@@ -411,7 +416,7 @@ func TestRemoveRootNode(t *testing.T) {
 	p := newPoint(0, 0)
 	tree.Insert(p)
 
-	tree.Remove(newPoint(0, 0))
+	tree.Remove(p)
 
 	if tree.numChildren != 0 {
 		t.Errorf(`Expected num children: %d, received: %d`, 0, tree.numChildren)
@@ -425,7 +430,7 @@ func TestRemoveFirstLevelNode(t *testing.T) {
 	p2 := newPoint(1, 0)
 	tree.Insert(p1, p2)
 
-	tree.Remove(newPoint(1, 0))
+	tree.Remove(p2)
 
 	if tree.numChildren != 1 {
 		t.Errorf(`Expected num children: %d, received: %d`, 1, tree.numChildren)
@@ -446,7 +451,7 @@ func TestRemoveDeepLevelNode(t *testing.T) {
 
 	tree.Insert(p1, p2, p3, p4)
 
-	tree.Remove(newPoint(2, 2))
+	tree.Remove(p3)
 
 	entries := tree.GetRange(newQuery(0, 5, 0, 5))
 
@@ -467,7 +472,7 @@ func TestRemoveNodesSecondDimension(t *testing.T) {
 
 	tree.Insert(p1, p2, p3)
 
-	tree.Remove(newPoint(0, 1))
+	tree.Remove(p2)
 
 	entries := tree.GetRange(newQuery(0, 1, 0, 5))
 
@@ -482,7 +487,7 @@ func TestRemoveAllSecondDimensionNodes(t *testing.T) {
 
 	tree.Insert(p1, p2)
 
-	tree.Remove(newPoint(0, 0), newPoint(0, 1))
+	tree.Remove(p1, p2)
 
 	if tree.numChildren != 0 {
 		t.Errorf(`Expected num children: %d, received: %d`, 0, tree.numChildren)
@@ -553,7 +558,9 @@ func TestRebalanceSingleDimension(t *testing.T) {
 	tree.Insert(p3)
 	tree.Insert(p4)
 
-	checkNumChildren(t, tree.root.right.right.right, 0)
+	// appending used to leave a chain down the right, inserts now rebalance
+	checkValue(t, tree.root, 3)
+	checkNumChildren(t, tree.root.right, 2)
 	tree.root.rebalance(tree)
 
 	entries := tree.GetRange(newQuery(0, 5, 0, 5))
@@ -599,6 +606,134 @@ func TestRebalanceSecondDimension(t *testing.T) {
 	checkValue(t, tree.root, 3)
 }
 
+func depth(n *node) int {
+	if n == nil || n.isLeaf() {
+		return 0
+	}
+
+	left, right := depth(n.left), depth(n.right)
+	if left > right {
+		return left + 1
+	}
+
+	return right + 1
+}
+
+func checkBalanced(t *testing.T, tree *tree, ratio float64) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n.isLeaf() {
+			if n.rt != nil {
+				checkBalanced(t, n.rt, ratio)
+			}
+			return
+		}
+
+		total := float64(n.size())
+		if float64(n.left.size())/total < ratio || float64(n.right.size())/total < ratio {
+			t.Errorf(
+				`Unbalanced node %d, left: %d, right: %d`,
+				n.value, n.left.size(), n.right.size(),
+			)
+		}
+
+		walk(n.left)
+		walk(n.right)
+	}
+
+	if tree.root != nil {
+		walk(tree.root)
+	}
+}
+
+func TestAppendingStaysBalanced(t *testing.T) {
+	tree := New(2)
+
+	for i := 0; i < 1024; i++ {
+		tree.Insert(newPoint(i, 0))
+	}
+
+	checkBalanced(t, tree, DefaultBalance)
+	checkTreeCounts(t, tree)
+
+	if d := depth(tree.root); d > 20 {
+		t.Errorf(`Expected logarithmic depth, received: %d`, d)
+	}
+
+	for i := 0; i < 1024; i++ { // a single row in the second dimension
+		tree.Insert(newPoint(2000, i))
+	}
+
+	checkBalanced(t, tree, DefaultBalance)
+	checkLen(t, tree.GetRange(newQuery(0, 3000, 0, 3000)), 2048)
+}
+
+func TestRemovingStaysBalanced(t *testing.T) {
+	points := make([]r.Entry, 1024)
+	for i := range points {
+		points[i] = newPoint(i, i)
+	}
+
+	tree := New(2, points...)
+
+	for i := 0; i < 900; i++ { // remove from the left edge only
+		tree.Remove(points[i])
+	}
+
+	checkBalanced(t, tree, DefaultBalance)
+	checkTreeCounts(t, tree)
+	checkLen(t, tree.GetRange(newQuery(0, 1024, 0, 1024)), 124)
+}
+
+func TestBalanceOption(t *testing.T) {
+	tree := NewWithOptions(2, Options{Balance: .1})
+
+	for i := 0; i < 512; i++ {
+		tree.Insert(newPoint(i, i))
+	}
+
+	checkBalanced(t, tree, .1)
+	checkTreeCounts(t, tree)
+
+	cp := tree.copy()
+	if cp.options.balance() != .1 {
+		t.Errorf(`Expected balance: %f, received: %f`, .1, cp.options.balance())
+	}
+
+	leaf := tree.root
+	for !leaf.isLeaf() {
+		leaf = leaf.left
+	}
+
+	if leaf.rt.options != tree.options {
+		t.Errorf(`Expected nested trees to share options.`)
+	}
+}
+
+func TestInvalidBalance(t *testing.T) {
+	for _, balance := range []float64{-.1, .34, .5, 1} {
+		if _, err := NewChecked(2, Options{Balance: balance}); !errors.Is(err, ErrInvalidBalance) {
+			t.Errorf(`%v: expected invalid balance, received: %v`, balance, err)
+		}
+
+		if _, err := NewSorted(2, Options{Balance: balance}, nil); !errors.Is(err, ErrInvalidBalance) {
+			t.Errorf(`%v: expected invalid balance, received: %v`, balance, err)
+		}
+	}
+
+	tree, err := NewChecked(2, Options{Balance: 1. / 3})
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	for i := 0; i < 512; i++ {
+		tree.Insert(newPoint(i, i))
+	}
+
+	checkBalanced(t, tree, 1./3)
+	checkTreeCounts(t, tree)
+}
+
 func TestInsertOverwritesRoot(t *testing.T) {
 	p1 := newPoint(0, 0)
 
@@ -699,6 +834,893 @@ func TestInsertWideRanges(t *testing.T) {
 	checkEntries(t, entries, newCoordinate(0, 3), newCoordinate(1, 0))
 }
 
+func TestRangeVisitsMatches(t *testing.T) {
+	tree := New(2)
+
+	tree.Insert(
+		newPoint(0, 0), newPoint(1, 1), newPoint(2, 2), newPoint(3, 3),
+	)
+
+	entries := make([]r.Entry, 0)
+	tree.Range(newQuery(1, 3, 0, 4), func(entry r.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	checkEntries(t, entries, newCoordinate(1, 1), newCoordinate(2, 2))
+}
+
+func TestRangeStopsEarly(t *testing.T) {
+	tree := New(2)
+
+	tree.Insert(
+		newPoint(0, 0), newPoint(0, 1), newPoint(1, 1), newPoint(2, 2),
+	)
+
+	visited := 0
+	tree.Range(newQuery(0, 3, 0, 3), func(entry r.Entry) bool {
+		visited++
+		return visited < 2
+	})
+
+	if visited != 2 {
+		t.Errorf(`Expected visited: %d, received: %d`, 2, visited)
+	}
+}
+
+func TestRangeEmptyTree(t *testing.T) {
+	tree := New(2)
+
+	tree.Range(newQuery(0, 10, 0, 10), func(entry r.Entry) bool {
+		t.Errorf(`Expected no entries, received: %+v`, entry)
+		return true
+	})
+}
+
+func TestIter(t *testing.T) {
+	tree := New(2)
+
+	tree.Insert(newPoint(0, 3), newPoint(1, 0), newPoint(5, 5))
+
+	entries := make([]r.Entry, 0)
+	for entry := range tree.Iter(newQuery(0, 2, 0, 4)) {
+		entries = append(entries, entry)
+	}
+
+	checkEntries(t, entries, newCoordinate(0, 3), newCoordinate(1, 0))
+
+	for entry := range tree.Iter(newQuery(0, 6, 0, 6)) {
+		checkCoordinates(t, entry, 0, 3)
+		break
+	}
+}
+
+func BenchmarkRangeSmallMatch(b *testing.B) {
+	numItems := 100000
+
+	points := make([]r.Entry, numItems)
+	for i := 0; i < numItems; i++ {
+		points[i] = newPoint(i, i)
+	}
+
+	tree := New(2, points...)
+	q := newQuery(10, 13, 0, numItems)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Range(q, func(entry r.Entry) bool {
+			return true
+		})
+	}
+}
+
+/*
+walks the tree verifying every internal node's numChildren matches the
+number of leaves below it
+*/
+func checkTreeCounts(t *testing.T, tree *tree) {
+	if tree.root == nil {
+		if tree.numChildren != 0 {
+			t.Errorf(`Expected num children: %d, received: %d`, 0, tree.numChildren)
+		}
+		return
+	}
+
+	var walk func(n *node) (int, int)
+	walk = func(n *node) (int, int) {
+		if n.isLeaf() {
+			if n.rt != nil {
+				checkTreeCounts(t, n.rt)
+			}
+			return n.size(), len(n.duplicates)
+		}
+
+		leftLeaves, leftDuplicates := walk(n.left)
+		rightLeaves, rightDuplicates := walk(n.right)
+		checkNumChildren(t, n, leftLeaves+rightLeaves)
+		if duplicates := leftDuplicates + rightDuplicates; n.numDuplicates != duplicates {
+			t.Errorf(`Expected num duplicates: %d, received: %d`, duplicates, n.numDuplicates)
+		}
+		return leftLeaves + rightLeaves, leftDuplicates + rightDuplicates
+	}
+
+	walk(tree.root)
+
+	if entries := len(tree.All()); entries != tree.numChildren {
+		t.Errorf(`Expected num children: %d, received: %d`, entries, tree.numChildren)
+	}
+}
+
+func bruteForceCount(points []*point, q *query) int {
+	count := 0
+	for _, p := range points {
+		if p.x() >= q.coordinates[0].low && p.x() < q.coordinates[0].high &&
+			p.y() >= q.coordinates[1].low && p.y() < q.coordinates[1].high {
+			count++
+		}
+	}
+
+	return count
+}
+
+func randomPoints(rnd *rand.Rand, num, max int) []*point {
+	seen := make(map[[2]int]bool)
+	points := make([]*point, 0, num)
+	for len(points) < num {
+		p := newPoint(rnd.Intn(max), rnd.Intn(max))
+		if seen[p.coordinates] {
+			continue
+		}
+
+		seen[p.coordinates] = true
+		points = append(points, p)
+	}
+
+	return points
+}
+
+func checkRandomCounts(t *testing.T, rnd *rand.Rand, tree *tree, points []*point, max int) {
+	for i := 0; i < 50; i++ {
+		x1, x2 := rnd.Intn(max+2)-1, rnd.Intn(max+2)-1
+		y1, y2 := rnd.Intn(max+2)-1, rnd.Intn(max+2)-1
+		if x1 > x2 {
+			x1, x2 = x2, x1
+		}
+		if y1 > y2 {
+			y1, y2 = y2, y1
+		}
+
+		q := newQuery(x1, x2, y1, y2)
+		expected := bruteForceCount(points, q)
+		if count := tree.Count(q); count != expected {
+			t.Errorf(`Expected count: %d, received: %d for %+v`, expected, count, q)
+		}
+
+		checkLen(t, tree.GetRange(q), expected)
+	}
+}
+
+func TestCount(t *testing.T) {
+	tree := New(2)
+
+	tree.Insert(newPoint(0, 0), newPoint(0, 1), newPoint(1, 1), newPoint(2, 3))
+
+	if count := tree.Count(newQuery(0, 3, 0, 4)); count != 4 {
+		t.Errorf(`Expected count: %d, received: %d`, 4, count)
+	}
+
+	if count := tree.Count(newQuery(0, 1, 1, 2)); count != 1 {
+		t.Errorf(`Expected count: %d, received: %d`, 1, count)
+	}
+
+	if count := tree.Count(newQuery(5, 6, 0, 4)); count != 0 {
+		t.Errorf(`Expected count: %d, received: %d`, 0, count)
+	}
+
+	if count := New(2).Count(newQuery(0, 1, 0, 1)); count != 0 {
+		t.Errorf(`Expected count: %d, received: %d`, 0, count)
+	}
+}
+
+func TestCountMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	max := 30
+
+	points := randomPoints(rnd, 300, max)
+	entries := make([]r.Entry, len(points))
+	for i, p := range points {
+		entries[i] = p
+	}
+
+	tree := New(2, entries[0:100]...)
+	checkRandomCounts(t, rnd, tree, points[0:100], max)
+
+	for _, p := range points[100:200] { // one at a time in random order
+		tree.Insert(p)
+	}
+	tree.Insert(entries[200:]...)
+
+	checkTreeCounts(t, tree)
+	checkRandomCounts(t, rnd, tree, points, max)
+
+	for _, p := range points[0:150] {
+		tree.Remove(p)
+	}
+
+	checkTreeCounts(t, tree)
+	checkRandomCounts(t, rnd, tree, points[150:], max)
+}
+
+func TestInsertBelowLeafValue(t *testing.T) {
+	tree := New(2)
+
+	tree.Insert(newPoint(10, 10))
+	tree.Insert(newPoint(1, 1), newPoint(2, 2), newPoint(3, 3))
+
+	entries := tree.GetRange(newQuery(0, 5, 0, 5))
+
+	checkEntries(
+		t, entries,
+		newCoordinate(1, 1),
+		newCoordinate(2, 2),
+		newCoordinate(3, 3),
+	)
+
+	checkTreeCounts(t, tree)
+}
+
+func TestCopyIsIndependent(t *testing.T) {
+	original := New(2, newPoint(0, 0), newPoint(0, 1), newPoint(1, 1))
+
+	cp := original.Copy()
+	original.Remove(newPoint(0, 1))
+	original.Insert(newPoint(2, 2))
+
+	if cp.Len() != 3 {
+		t.Errorf(`Expected len: %d, received: %d`, 3, cp.Len())
+	}
+
+	checkEntries(
+		t, cp.GetRange(newQuery(0, 3, 0, 3)),
+		newCoordinate(0, 0),
+		newCoordinate(0, 1),
+		newCoordinate(1, 1),
+	)
+	checkTreeCounts(t, cp.(*tree))
+}
+
+/*
+a point whose Less only compares up to the given dimension, as the Entry
+documentation allows
+*/
+type cell struct {
+	point
+}
+
+func (self *cell) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) < 0
+}
+
+func newCell(x, y int) *cell {
+	return &cell{point{[2]int{x, y}}}
+}
+
+/*
+a point whose Less disagrees with its dimensional values
+*/
+type backwards struct {
+	point
+}
+
+func (self *backwards) Less(other r.Entry, dimension int) bool {
+	return r.Compare(self, other, dimension) > 0
+}
+
+type wide struct {
+	point
+}
+
+func (self *wide) MaxDimensions() int {
+	return 3
+}
+
+func TestInsertSortsEveryDimension(t *testing.T) {
+	tree := New(2)
+
+	tree.Insert(newCell(0, 3), newCell(0, 1), newCell(1, 0), newCell(0, 2))
+
+	entries := tree.GetRange(newQuery(0, 1, 2, 4))
+	checkLen(t, entries, 2)
+	checkTreeCounts(t, tree)
+}
+
+func TestInsertChecked(t *testing.T) {
+	tree := New(2, newPoint(0, 0))
+
+	err := tree.InsertChecked(newPoint(1, 1), nil)
+	if !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+
+	err = tree.InsertChecked(newPoint(1, 1), &wide{*newPoint(2, 2)})
+	if !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	err = tree.InsertChecked(
+		&backwards{*newPoint(1, 1)}, &backwards{*newPoint(2, 2)},
+	)
+	if !errors.Is(err, r.ErrInconsistentOrder) {
+		t.Errorf(`Expected inconsistent order, received: %v`, err)
+	}
+
+	if tree.Len() != 1 {
+		t.Errorf(`Expected nothing inserted, received len: %d`, tree.Len())
+	}
+
+	if err := tree.InsertChecked(newPoint(1, 1)); err != nil {
+		t.Errorf(`Unexpected error: %v`, err)
+	}
+
+	checkLen(t, tree.All(), 2)
+}
+
+func TestCheckedLeavesCallerOrder(t *testing.T) {
+	a, b := &backwards{*newPoint(1, 1)}, &backwards{*newPoint(2, 2)}
+	entries := []r.Entry{a, b}
+
+	if err := New(2).InsertChecked(entries...); !errors.Is(err, r.ErrInconsistentOrder) {
+		t.Errorf(`Expected inconsistent order, received: %v`, err)
+	}
+
+	if _, err := NewChecked(2, Options{}, entries...); !errors.Is(err, r.ErrInconsistentOrder) {
+		t.Errorf(`Expected inconsistent order, received: %v`, err)
+	}
+
+	if entries[0] != a || entries[1] != b {
+		t.Errorf(`Expected the caller's slice in its order, received: %+v`, entries)
+	}
+
+	c, d := newPoint(2, 2), newPoint(1, 1)
+	entries = []r.Entry{c, d}
+	New(2, entries...).Insert(entries...)
+
+	if entries[0] != c || entries[1] != d {
+		t.Errorf(`Expected the caller's slice in its order, received: %+v`, entries)
+	}
+}
+
+func TestRemoveChecked(t *testing.T) {
+	a := newPoint(0, 0)
+	tree := New(2, a, newPoint(1, 1))
+
+	err := tree.RemoveChecked(a, nil)
+	if !errors.Is(err, r.ErrNilEntry) {
+		t.Errorf(`Expected nil entry, received: %v`, err)
+	}
+
+	if tree.Len() != 2 {
+		t.Errorf(`Expected nothing removed, received len: %d`, tree.Len())
+	}
+
+	if err := tree.RemoveChecked(a); err != nil {
+		t.Errorf(`Unexpected error: %v`, err)
+	}
+
+	checkEntries(t, tree.All(), newCoordinate(1, 1))
+}
+
+func TestNewChecked(t *testing.T) {
+	_, err := NewChecked(2, Options{}, newPoint(0, 0), &wide{*newPoint(1, 1)})
+	if !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	tree, err := NewChecked(2, Options{}, newPoint(0, 0))
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkLen(t, tree.All(), 1)
+}
+
+func TestInsertPanicsOnInvalidEntry(t *testing.T) {
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, r.ErrNilEntry) {
+			t.Errorf(`Expected nil entry panic, received: %v`, err)
+		}
+	}()
+
+	New(2).Insert(nil)
+}
+
+func TestGet(t *testing.T) {
+	p := newPoint(1, 3)
+	tree := New(2, newPoint(0, 0), newPoint(1, 1), p, newPoint(2, 3))
+
+	entries := tree.Get(1, 3)
+	checkLen(t, entries, 1)
+	if len(entries) == 1 && entries[0] != p {
+		t.Errorf(`Expected entry: %+v, received: %+v`, p, entries[0])
+	}
+
+	if entries := tree.Get(1, 2); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+
+	if entries := tree.Get(3, 3); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+
+	if entries := tree.Get(1); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+
+	if entries := New(2).Get(0, 0); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+}
+
+func TestContains(t *testing.T) {
+	p := newPoint(1, 1)
+	tree := New(2, newPoint(0, 0), p)
+
+	if !tree.Contains(p) {
+		t.Errorf(`Expected tree to contain (1, 1).`)
+	}
+
+	if tree.Contains(newPoint(1, 1)) {
+		t.Errorf(`Expected tree not to contain another entry at (1, 1).`)
+	}
+
+	if tree.Contains(newPoint(1, 0)) {
+		t.Errorf(`Expected tree not to contain (1, 0).`)
+	}
+
+	if tree.Contains(nil) {
+		t.Errorf(`Expected tree not to contain nil.`)
+	}
+
+	tree.Remove(p)
+	if tree.Contains(p) {
+		t.Errorf(`Expected tree not to contain (1, 1) after remove.`)
+	}
+}
+
+func TestGetDoesNotAllocate(t *testing.T) {
+	tree := New(2, newPoint(0, 0), newPoint(1, 1), newPoint(2, 2))
+
+	if allocs := testing.AllocsPerRun(100, func() { tree.Get(1, 2) }); allocs != 0 {
+		t.Errorf(`Expected a miss not to allocate, received: %v`, allocs)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { tree.Get(1, 1) }); allocs != 1 {
+		t.Errorf(`Expected a hit to allocate only its result, received: %v`, allocs)
+	}
+}
+
+func TestGetMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	points := randomPoints(rnd, 200, 20)
+
+	tree := New(2)
+	present := make(map[[2]int]bool)
+	for _, p := range points {
+		tree.Insert(p)
+		present[p.coordinates] = true
+	}
+
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 20; y++ {
+			found := len(tree.Get(x, y)) == 1
+			if found != present[[2]int{x, y}] {
+				t.Errorf(`Expected found: %t at (%d, %d)`, present[[2]int{x, y}], x, y)
+			}
+		}
+	}
+}
+
+func TestDuplicateModes(t *testing.T) {
+	first, second, third := newPoint(1, 1), newPoint(1, 1), newPoint(1, 1)
+
+	tests := []struct {
+		mode     r.DuplicateMode
+		expected []r.Entry
+	}{
+		{r.Replace, []r.Entry{third}},
+		{r.Set, []r.Entry{first}},
+		{r.Multiset, []r.Entry{first, second, third}},
+	}
+
+	for _, test := range tests {
+		tree := NewWithOptions(2, Options{Duplicates: test.mode}, newPoint(0, 0), first, second)
+		tree.Insert(third)
+
+		entries := tree.Get(1, 1)
+		if len(entries) != len(test.expected) {
+			t.Errorf(`%v: expected len: %d, received: %d`, test.mode, len(test.expected), len(entries))
+			continue
+		}
+
+		for i, entry := range entries {
+			if entry != test.expected[i] {
+				t.Errorf(`%v: expected entry: %p, received: %p`, test.mode, test.expected[i], entry)
+			}
+		}
+
+		if tree.Len() != len(test.expected)+1 {
+			t.Errorf(`%v: expected len: %d, received: %d`, test.mode, len(test.expected)+1, tree.Len())
+		}
+
+		if count := tree.Count(newQuery(0, 2, 0, 2)); count != tree.Len() {
+			t.Errorf(`%v: expected count: %d, received: %d`, test.mode, tree.Len(), count)
+		}
+
+		checkLen(t, tree.GetRange(newQuery(1, 2, 1, 2)), len(test.expected))
+		checkTreeCounts(t, tree)
+	}
+}
+
+type tagged struct {
+	point
+	id int
+}
+
+func (self *tagged) Equal(other r.Entry) bool {
+	o, ok := other.(*tagged)
+	return ok && o.id == self.id
+}
+
+func TestMultisetRemovesExactEntry(t *testing.T) {
+	first, second := newPoint(1, 1), newPoint(1, 1)
+	tree := NewWithOptions(2, Options{Duplicates: r.Multiset}, first, second, newPoint(2, 2))
+
+	if tree.Contains(newPoint(1, 1)) {
+		t.Errorf(`Expected tree not to contain an unknown entry.`)
+	}
+
+	tree.Remove(newPoint(1, 1))
+	checkLen(t, tree.Get(1, 1), 2)
+
+	tree.Remove(first)
+	if entries := tree.Get(1, 1); len(entries) != 1 || entries[0] != second {
+		t.Errorf(`Expected only: %p, received: %+v`, second, entries)
+	}
+
+	if tree.Contains(first) || !tree.Contains(second) {
+		t.Errorf(`Expected tree to contain only the second entry.`)
+	}
+
+	tree.Remove(second)
+	if entries := tree.Get(1, 1); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+
+	checkTreeCounts(t, tree)
+	if tree.Len() != 1 {
+		t.Errorf(`Expected len: %d, received: %d`, 1, tree.Len())
+	}
+
+	a := &tagged{*newPoint(3, 3), 1}
+	b := &tagged{*newPoint(3, 3), 2}
+	tree.Insert(a, b)
+	tree.Remove(&tagged{*newPoint(3, 3), 2})
+
+	if entries := tree.Get(3, 3); len(entries) != 1 || entries[0] != a {
+		t.Errorf(`Expected only: %p, received: %+v`, a, entries)
+	}
+}
+
+func TestMultisetMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	multiset := NewWithOptions(2, Options{Duplicates: r.Multiset})
+	points := make([]*point, 0)
+
+	for i := 0; i < 500; i++ {
+		if len(points) > 0 && rnd.Intn(3) == 0 {
+			j := rnd.Intn(len(points))
+			multiset.Remove(points[j])
+			points = append(points[:j], points[j+1:]...)
+		} else {
+			p := newPoint(rnd.Intn(6), rnd.Intn(6))
+			multiset.Insert(p)
+			points = append(points, p)
+		}
+	}
+
+	checkTreeCounts(t, multiset)
+	checkRandomCounts(t, rnd, multiset, points, 6)
+
+	if multiset.Len() != len(points) {
+		t.Errorf(`Expected len: %d, received: %d`, len(points), multiset.Len())
+	}
+
+	cp := multiset.Copy().(*tree)
+	for _, p := range points {
+		if !cp.Contains(p) {
+			t.Errorf(`Expected copy to contain: %p`, p)
+		}
+		cp.Remove(p)
+	}
+
+	if cp.Len() != 0 || multiset.Len() != len(points) {
+		t.Errorf(`Expected the copy to empty independently.`)
+	}
+}
+
+func TestHeavyMultisetLeaf(t *testing.T) {
+	heavy := make([]r.Entry, 20000)
+	for i := range heavy {
+		heavy[i] = newPoint(0, 0)
+	}
+
+	// the same inserts beside a heavy leaf and beside a single entry
+	allocated := make([]uint64, 0, 2)
+	for _, entries := range [][]r.Entry{heavy, heavy[:1]} {
+		tree := NewWithOptions(2, Options{Duplicates: r.Multiset}, entries...)
+		rnd := rand.New(rand.NewSource(13))
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for i := 0; i < 6000; i++ {
+			tree.Insert(newPoint(0, rnd.Intn(1<<20)-1<<19))
+		}
+		runtime.ReadMemStats(&after)
+		allocated = append(allocated, after.TotalAlloc-before.TotalAlloc)
+
+		checkTreeCounts(t, tree)
+		if count := tree.Count(r.NewQuery(r.Closed(0, 0), r.Closed(0, 0))); count < len(entries) {
+			t.Errorf(`Expected count: at least %d, received: %d`, len(entries), count)
+		}
+	}
+
+	// rebuilding the ancestors of the heavy leaf on every insert would
+	// allocate in proportion to the tree each time
+	if allocated[0] > 2*allocated[1] {
+		t.Errorf(`Expected a heavy leaf to cost nothing more, received: %d bytes against %d`, allocated[0], allocated[1])
+	}
+}
+
+func TestUpdateTrailingDimension(t *testing.T) {
+	p := newPoint(1, 1)
+	tree := New(2, newPoint(0, 0), p, newPoint(1, 5), newPoint(2, 2))
+	leaf := tree.root.find(1)
+
+	moved := newPoint(1, 3)
+	if !tree.Update(p, moved) {
+		t.Fatalf(`Expected to find: %+v`, p)
+	}
+
+	if tree.root.find(1) != leaf {
+		t.Errorf(`Expected the first dimension to be left alone.`)
+	}
+
+	if entries := tree.Get(1, 3); len(entries) != 1 || entries[0] != moved {
+		t.Errorf(`Expected entry: %+v, received: %+v`, moved, entries)
+	}
+
+	if entries := tree.Get(1, 1); entries != nil {
+		t.Errorf(`Expected nil, received: %+v`, entries)
+	}
+
+	checkTreeCounts(t, tree)
+	if tree.Len() != 4 {
+		t.Errorf(`Expected len: %d, received: %d`, 4, tree.Len())
+	}
+}
+
+func TestUpdateFirstDimension(t *testing.T) {
+	p, moved := newPoint(1, 1), newPoint(5, 1)
+	tree := New(2, newPoint(0, 0), p, newPoint(2, 2))
+
+	if !tree.Update(p, moved) {
+		t.Fatalf(`Expected to find (1, 1).`)
+	}
+
+	checkLen(t, tree.GetRange(newQuery(1, 2, 0, 10)), 0)
+	checkLen(t, tree.GetRange(newQuery(5, 6, 1, 2)), 1)
+
+	// moving onto an occupied cell replaces what was there
+	if !tree.Update(moved, newPoint(2, 2)) {
+		t.Fatalf(`Expected to find (5, 1).`)
+	}
+
+	checkTreeCounts(t, tree)
+	if tree.Len() != 2 {
+		t.Errorf(`Expected len: %d, received: %d`, 2, tree.Len())
+	}
+}
+
+func TestUpdateNotFound(t *testing.T) {
+	tree := New(2, newPoint(0, 0), newPoint(1, 1))
+
+	if tree.Update(newPoint(1, 0), newPoint(3, 3)) || tree.Update(newPoint(4, 4), newPoint(4, 5)) {
+		t.Errorf(`Expected missing entries not to be found.`)
+	}
+
+	if tree.Len() != 2 || tree.Contains(newPoint(3, 3)) || tree.Contains(newPoint(4, 5)) {
+		t.Errorf(`Expected the tree to be unchanged.`)
+	}
+
+	multiset := NewWithOptions(2, Options{Duplicates: r.Multiset}, newPoint(1, 1))
+	if multiset.Update(newPoint(1, 1), newPoint(1, 2)) {
+		t.Errorf(`Expected a multiset to match the exact entry.`)
+	}
+}
+
+func TestUpdateMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(17))
+	max := 10
+
+	points := randomPoints(rnd, 100, max)
+	tree := New(2)
+	state := make(map[[2]int]*point)
+	for _, p := range points {
+		tree.Insert(p)
+		state[p.coordinates] = p
+	}
+
+	for i := 0; i < 300; i++ {
+		old := newPoint(rnd.Intn(max), rnd.Intn(max))
+		if existing, ok := state[old.coordinates]; ok && rnd.Intn(4) != 0 {
+			old = existing
+		}
+
+		entry := newPoint(old.x(), rnd.Intn(max))
+		if rnd.Intn(2) == 0 {
+			entry = newPoint(rnd.Intn(max), rnd.Intn(max))
+		}
+
+		expected := state[old.coordinates] == old
+		if found := tree.Update(old, entry); found != expected {
+			t.Fatalf(`Expected found: %t, received: %t`, expected, found)
+		}
+
+		if expected {
+			delete(state, old.coordinates)
+			state[entry.coordinates] = entry
+		}
+	}
+
+	remaining := make([]*point, 0, len(state))
+	for _, p := range state {
+		remaining = append(remaining, p)
+	}
+
+	checkTreeCounts(t, tree)
+	checkRandomCounts(t, rnd, tree, remaining, max)
+}
+
+func TestRemoveRange(t *testing.T) {
+	tree := New(2, newPoint(0, 0), newPoint(0, 1), newPoint(1, 1), newPoint(2, 3), newPoint(3, 1))
+
+	if removed := tree.RemoveRange(newQuery(0, 3, 1, 2)); removed != 2 {
+		t.Errorf(`Expected removed: %d, received: %d`, 2, removed)
+	}
+
+	checkLen(t, tree.All(), 3)
+	checkTreeCounts(t, tree)
+
+	if tree.Contains(newPoint(0, 1)) || tree.Contains(newPoint(1, 1)) {
+		t.Errorf(`Expected (0, 1) and (1, 1) to be removed.`)
+	}
+
+	if removed := tree.RemoveRange(newQuery(5, 10, 0, 10)); removed != 0 {
+		t.Errorf(`Expected removed: %d, received: %d`, 0, removed)
+	}
+
+	if removed := tree.RemoveRange(newQuery(0, 10, 0, 10)); removed != 3 {
+		t.Errorf(`Expected removed: %d, received: %d`, 3, removed)
+	}
+
+	if tree.root != nil || tree.Len() != 0 {
+		t.Errorf(`Expected empty tree, received: %+v`, tree)
+	}
+
+	if removed := tree.RemoveRange(newQuery(0, 10, 0, 10)); removed != 0 {
+		t.Errorf(`Expected removed: %d, received: %d`, 0, removed)
+	}
+}
+
+func TestRemoveRangeMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(19))
+	max := 30
+
+	for i := 0; i < 20; i++ {
+		points := randomPoints(rnd, 300, max)
+		entries := make([]r.Entry, len(points))
+		for j, p := range points {
+			entries[j] = p
+		}
+
+		tree := New(2, entries...)
+		x, y := rnd.Intn(max), rnd.Intn(max)
+		q := newQuery(x, x+rnd.Intn(max), y, y+rnd.Intn(max))
+
+		expected := bruteForceCount(points, q)
+		if removed := tree.RemoveRange(q); removed != expected {
+			t.Errorf(`Expected removed: %d, received: %d`, expected, removed)
+		}
+
+		remaining := make([]*point, 0, len(points))
+		for _, p := range points {
+			if bruteForceCount([]*point{p}, q) == 0 {
+				remaining = append(remaining, p)
+			}
+		}
+
+		checkTreeCounts(t, tree)
+		checkBalanced(t, tree, DefaultBalance)
+		checkRandomCounts(t, rnd, tree, remaining, max)
+	}
+}
+
+func TestRemoveRangeMultiset(t *testing.T) {
+	tree := NewWithOptions(2, Options{Duplicates: r.Multiset},
+		newPoint(1, 1), newPoint(1, 1), newPoint(1, 2), newPoint(2, 2))
+
+	if removed := tree.RemoveRange(newQuery(0, 2, 0, 2)); removed != 2 {
+		t.Errorf(`Expected removed: %d, received: %d`, 2, removed)
+	}
+
+	checkTreeCounts(t, tree)
+	if tree.Len() != 2 {
+		t.Errorf(`Expected len: %d, received: %d`, 2, tree.Len())
+	}
+}
+
+func TestQueryBounds(t *testing.T) {
+	tree := New(2, newPoint(0, 0), newPoint(0, math.MaxInt), newPoint(1, 5),
+		newPoint(2, 5), newPoint(math.MinInt, 3), newPoint(3, 9))
+
+	tests := []struct {
+		query    r.Query
+		expected int
+	}{
+		{r.NewQuery(), 6},
+		{r.NewQuery(nil, nil), 6},
+		{r.NewQuery(r.All(), r.AtLeast(5)), 4},
+		{r.NewQuery(nil, r.Above(5)), 2},
+		{r.NewQuery(r.Closed(0, 2), r.Closed(5, 5)), 2},
+		{r.NewQuery(r.Open(0, 2), nil), 1},
+		{r.NewQuery(r.Below(1)), 3},
+		{r.NewQuery(r.AtMost(math.MinInt)), 1},
+		{r.NewQuery(r.Closed(0, 0), r.Closed(math.MaxInt, math.MaxInt)), 1},
+		{r.NewQuery(r.Closed(2, 1)), 0},
+	}
+
+	for _, test := range tests {
+		checkLen(t, tree.GetRange(test.query), test.expected)
+		if count := tree.Count(test.query); count != test.expected {
+			t.Errorf(`Expected count: %d, received: %d`, test.expected, count)
+		}
+	}
+
+	if removed := tree.RemoveRange(r.NewQuery(nil, r.AtLeast(5))); removed != 4 {
+		t.Errorf(`Expected removed: %d, received: %d`, 4, removed)
+	}
+	checkTreeCounts(t, tree)
+}
+
+func BenchmarkGet(b *testing.B) {
+	numItems := 100000
+
+	points := make([]r.Entry, numItems)
+	for i := 0; i < numItems; i++ {
+		points[i] = newPoint(i/100, i%100)
+	}
+
+	tree := New(2, points...)
+	p := newPoint(500, 50)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Contains(p)
+	}
+}
+
 func BenchmarkFirstDimensionRange(b *testing.B) {
 	log.Printf(`N: %d`, b.N)
 	numItems := 10
@@ -803,3 +1825,15 @@ func BenchmarkEditCells(b *testing.B) {
 		)
 	}
 }
+
+func TestConformance(t *testing.T) {
+	rangetreetest.RunConformance(t, func(maxDimensions int, entries ...r.Entry) r.RangeTree {
+		return New(maxDimensions, entries...)
+	})
+}
+
+func TestConformanceWithModes(t *testing.T) {
+	rangetreetest.RunConformanceWithModes(t, func(maxDimensions int, mode r.DuplicateMode, entries ...r.Entry) r.RangeTree {
+		return NewWithOptions(maxDimensions, Options{Duplicates: mode}, entries...)
+	})
+}
@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"fmt"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+a query bounded in one dimension only
+*/
+type band struct {
+	dimension int
+	bounds    r.Bounds
+}
+
+func (self band) GetDimensionalBounds(dimension int) r.Bounds {
+	if dimension == self.dimension {
+		return self.bounds
+	}
+
+	return nil
+}
+
+/*
+Moves every entry whose value in dimension is >= from by delta, like
+inserting or deleting rows of a spreadsheet.  A negative delta first
+removes the entries in the vacated band [from+delta, from), those are
+returned.  Every entry that moves must implement rangetree.Shifter and is
+replaced in the tree by the result of its Shift.
+
+Shifting keeps the order of the values in dimension so the tree is not
+restructured, its node values are rewritten in place.  In the first
+dimension the cost is linear in the number of entries moved plus the cost
+of removing the band.  In a later dimension every nested tree of the
+dimensions before it is visited, whether or not it holds an entry to move,
+so the cost grows with the number of distinct values in those dimensions
+and is linear in the size of the tree at worst.
+*/
+func (self *tree) Shift(dimension, from, delta int) ([]r.Entry, error) {
+	if dimension < 1 || dimension > self.maxDimensions {
+		return nil, fmt.Errorf(
+			`%w: %d, the tree has %d dimensions`, r.ErrInvalidDimension, dimension, self.maxDimensions,
+		)
+	}
+
+	if delta == 0 || self.root == nil {
+		return nil, nil
+	}
+
+	// check everything up front so a failed shift leaves the tree untouched
+	var err error
+	self.Range(band{dimension, r.AtLeast(from)}, func(entry r.Entry) bool {
+		if _, ok := entry.(r.Shifter); !ok {
+			err = fmt.Errorf(`%w: %T`, r.ErrNotShiftable, entry)
+		}
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []r.Entry
+	if delta < 0 {
+		deleted = self.GetRange(band{dimension, r.HalfOpen(from+delta, from)})
+		for _, entry := range deleted {
+			self.remove(entry)
+		}
+	}
+
+	if self.root != nil {
+		self.root.shift(self, dimension, from, delta)
+	}
+
+	return deleted, nil
+}
+
+/*
+moves the values >= from in the given dimension by delta, anything in the
+vacated band has already been removed
+*/
+func (self *node) shift(tree *tree, dimension, from, delta int) {
+	if tree.dimension < dimension { // every nested tree may hold entries to move
+		self.leaves(func(leaf *node) {
+			leaf.rt.root.shift(leaf.rt, dimension, from, delta)
+		})
+		return
+	}
+
+	if self.isLeaf() {
+		if self.value >= from {
+			self.move(tree, dimension, delta)
+		}
+		return
+	}
+
+	if self.value >= from {
+		self.left.shift(tree, dimension, from, delta)
+		self.right.move(tree, dimension, delta)
+		self.value += delta
+		self.refresh(tree)
+		return
+	}
+
+	// a key left over from a removed leaf in the band must not end up
+	// above the values to its right once they move down
+	if delta < 0 && self.value >= from+delta {
+		self.value = from + delta
+	}
+
+	self.right.shift(tree, dimension, from, delta)
+	self.refresh(tree)
+}
+
+/*
+moves every value of this subtree, and every entry below it, by delta
+*/
+func (self *node) move(tree *tree, dimension, delta int) {
+	self.value += delta
+	if !self.isLeaf() {
+		self.left.move(tree, dimension, delta)
+		self.right.move(tree, dimension, delta)
+		self.refresh(tree)
+		return
+	}
+
+	self.shiftEntries(tree, dimension, delta)
+}
+
+/*
+replaces every entry below this node with its shifted self, values in the
+later dimensions are unaffected
+*/
+func (self *node) shiftEntries(tree *tree, dimension, delta int) {
+	if !self.isLeaf() {
+		self.left.shiftEntries(tree, dimension, delta)
+		self.right.shiftEntries(tree, dimension, delta)
+		self.refresh(tree)
+		return
+	}
+
+	if self.rt != nil {
+		self.rt.root.shiftEntries(self.rt, dimension, delta)
+		return
+	}
+
+	self.entry = self.entry.(r.Shifter).Shift(dimension, delta)
+	for i, duplicate := range self.duplicates {
+		self.duplicates[i] = duplicate.(r.Shifter).Shift(dimension, delta)
+	}
+	self.refresh(tree)
+}
@@ -0,0 +1,201 @@
+package v1
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+a point that shifts into a new entry, leaving the original untouched
+*/
+type row struct {
+	point
+}
+
+func (self *row) Shift(dimension, delta int) r.Entry {
+	shifted := *self
+	shifted.coordinates[dimension-1] += delta
+	return &shifted
+}
+
+func newRow(x, y int) *row {
+	return &row{point{[2]int{x, y}}}
+}
+
+func rowGrid(rows, columns int) []r.Entry {
+	entries := make([]r.Entry, 0, rows*columns)
+	for x := 0; x < rows; x++ {
+		for y := 0; y < columns; y++ {
+			entries = append(entries, newRow(x, y))
+		}
+	}
+
+	return entries
+}
+
+func coordinatesOf(entries []r.Entry) map[[2]int]bool {
+	result := make(map[[2]int]bool, len(entries))
+	for _, entry := range entries {
+		result[[2]int{entry.GetDimensionalValue(1), entry.GetDimensionalValue(2)}] = true
+	}
+
+	return result
+}
+
+func checkShifted(t *testing.T, tree *tree, expected map[[2]int]bool) {
+	received := coordinatesOf(tree.All())
+	if len(received) != len(expected) || tree.Len() != len(expected) {
+		t.Errorf(`Expected len: %d, received: %d`, len(expected), tree.Len())
+	}
+
+	for coordinates := range expected {
+		if !received[coordinates] {
+			t.Errorf(`Expected: %+v, not found.`, coordinates)
+		}
+
+		if entries := tree.Get(coordinates[0], coordinates[1]); len(entries) != 1 {
+			t.Errorf(`Expected to get: %+v, received: %+v`, coordinates, entries)
+		}
+	}
+
+	checkTreeCounts(t, tree)
+}
+
+func TestShiftInsertsRows(t *testing.T) {
+	tree := New(2, rowGrid(5, 3)...)
+	original := tree.Get(3, 1)[0]
+
+	deleted, err := tree.Shift(1, 2, 3)
+	if err != nil || deleted != nil {
+		t.Fatalf(`Unexpected result: %+v, %v`, deleted, err)
+	}
+
+	expected := make(map[[2]int]bool)
+	for _, x := range []int{0, 1, 5, 6, 7} {
+		for y := 0; y < 3; y++ {
+			expected[[2]int{x, y}] = true
+		}
+	}
+
+	checkShifted(t, tree, expected)
+	checkLen(t, tree.GetRange(newQuery(2, 5, 0, 3)), 0)
+	checkLen(t, tree.GetRange(newQuery(5, 7, 1, 3)), 4)
+
+	if original.GetDimensionalValue(1) != 3 {
+		t.Errorf(`Expected the original entry to be left alone.`)
+	}
+
+	tree.Insert(newRow(2, 0), newRow(3, 0), newRow(4, 0))
+	tree.Remove(tree.Get(6, 2)...)
+	if tree.Len() != 17 || tree.Count(newQuery(0, 10, 0, 1)) != 8 {
+		t.Errorf(`Expected len: %d, count: %d, received: %d, %d`,
+			17, 8, tree.Len(), tree.Count(newQuery(0, 10, 0, 1)))
+	}
+	checkTreeCounts(t, tree)
+}
+
+func TestShiftDeletesBand(t *testing.T) {
+	tree := New(2, rowGrid(6, 2)...)
+
+	deleted, err := tree.Shift(1, 3, -2)
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkLen(t, deleted, 4)
+	for coordinates := range coordinatesOf(deleted) {
+		if coordinates[0] != 1 && coordinates[0] != 2 {
+			t.Errorf(`Expected only rows 1 and 2 deleted, received: %+v`, coordinates)
+		}
+	}
+
+	expected := make(map[[2]int]bool)
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			expected[[2]int{x, y}] = true
+		}
+	}
+
+	checkShifted(t, tree, expected)
+}
+
+func TestShiftSecondDimension(t *testing.T) {
+	tree := New(2, rowGrid(3, 4)...)
+
+	if _, err := tree.Shift(2, 2, 1); err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	expected := make(map[[2]int]bool)
+	for x := 0; x < 3; x++ {
+		for _, y := range []int{0, 1, 3, 4} {
+			expected[[2]int{x, y}] = true
+		}
+	}
+
+	checkShifted(t, tree, expected)
+	if count := tree.Count(newQuery(0, 3, 2, 3)); count != 0 {
+		t.Errorf(`Expected count: %d, received: %d`, 0, count)
+	}
+}
+
+func TestShiftMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(13))
+	max := 20
+
+	tree := New(2)
+	state := make(map[[2]int]bool)
+	for i := 0; i < 150; i++ {
+		x, y := rnd.Intn(max), rnd.Intn(max)
+		tree.Insert(newRow(x, y))
+		state[[2]int{x, y}] = true
+	}
+
+	for i := 0; i < 40; i++ {
+		dimension, from, delta := rnd.Intn(2)+1, rnd.Intn(max), rnd.Intn(9)-4
+
+		if _, err := tree.Shift(dimension, from, delta); err != nil {
+			t.Fatalf(`Unexpected error: %v`, err)
+		}
+
+		next := make(map[[2]int]bool)
+		for coordinates := range state {
+			value := coordinates[dimension-1]
+			if value >= from {
+				coordinates[dimension-1] += delta
+			} else if value >= from+delta {
+				continue
+			}
+			next[coordinates] = true
+		}
+		state = next
+
+		checkShifted(t, tree, state)
+
+		x, y := rnd.Intn(max), rnd.Intn(max)
+		tree.Insert(newRow(x, y))
+		state[[2]int{x, y}] = true
+	}
+}
+
+func TestShiftErrors(t *testing.T) {
+	tree := New(2, newRow(0, 0), newRow(1, 1))
+
+	if _, err := tree.Shift(3, 0, 1); !errors.Is(err, r.ErrInvalidDimension) {
+		t.Errorf(`Expected invalid dimension, received: %v`, err)
+	}
+
+	tree.Insert(newPoint(2, 2))
+	if _, err := tree.Shift(1, 1, -1); !errors.Is(err, r.ErrNotShiftable) {
+		t.Errorf(`Expected not shiftable, received: %v`, err)
+	}
+
+	checkShifted(t, tree, map[[2]int]bool{{0, 0}: true, {1, 1}: true, {2, 2}: true})
+
+	if _, err := tree.Shift(1, 3, 1); err != nil {
+		t.Errorf(`Expected nothing to move, received: %v`, err)
+	}
+}
@@ -0,0 +1,208 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+The on-disk layout of a snapshot, all integers are big endian:
+
+	magic          [4]byte  "RNGT"
+	version        uint16
+	maxDimensions  uint32
+	duplicates     uint8, the DuplicateMode of the tree
+	numEntries     uint64
+	numEntries times:
+		length     uint32
+		payload    [length]byte, as produced by the Codec
+
+Entries are written in tree order, sorted on every dimension, so a restore
+can rebuild the tree without sorting.  Version 1 snapshots have no
+duplicates field and are still read.
+*/
+const (
+	snapshotMagic   = `RNGT`
+	snapshotVersion = 2
+)
+
+var (
+	ErrInvalidSnapshot    = errors.New(`rangetree: invalid snapshot`)
+	ErrUnsupportedVersion = errors.New(`rangetree: unsupported snapshot version`)
+)
+
+/*
+Codec converts entries to and from the bytes stored in a snapshot.
+*/
+type Codec interface {
+	Encode(entry r.Entry) ([]byte, error)
+	Decode(data []byte) (r.Entry, error)
+}
+
+type snapshotHeader struct {
+	Magic         [4]byte
+	Version       uint16
+	MaxDimensions uint32
+	Duplicates    uint8
+	NumEntries    uint64
+}
+
+/*
+the header of a version 1 snapshot, from MaxDimensions on
+*/
+type snapshotHeaderV1 struct {
+	MaxDimensions uint32
+	NumEntries    uint64
+}
+
+/*
+reads the header of either version, returns whether the snapshot records
+its duplicate mode
+*/
+func readHeader(rd io.Reader, header *snapshotHeader) (bool, error) {
+	if err := binary.Read(rd, binary.BigEndian, &header.Magic); err != nil {
+		return false, fmt.Errorf(`%w: reading header: %v`, ErrInvalidSnapshot, err)
+	}
+
+	if string(header.Magic[:]) != snapshotMagic {
+		return false, fmt.Errorf(`%w: bad magic %q`, ErrInvalidSnapshot, header.Magic)
+	}
+
+	if err := binary.Read(rd, binary.BigEndian, &header.Version); err != nil {
+		return false, fmt.Errorf(`%w: reading header: %v`, ErrInvalidSnapshot, err)
+	}
+
+	switch header.Version {
+	case 1:
+		var v1 snapshotHeaderV1
+		if err := binary.Read(rd, binary.BigEndian, &v1); err != nil {
+			return false, fmt.Errorf(`%w: reading header: %v`, ErrInvalidSnapshot, err)
+		}
+
+		header.MaxDimensions, header.NumEntries = v1.MaxDimensions, v1.NumEntries
+		return false, nil
+	case snapshotVersion:
+		rest := []any{&header.MaxDimensions, &header.Duplicates, &header.NumEntries}
+		for _, field := range rest {
+			if err := binary.Read(rd, binary.BigEndian, field); err != nil {
+				return false, fmt.Errorf(`%w: reading header: %v`, ErrInvalidSnapshot, err)
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, fmt.Errorf(`%w: %d`, ErrUnsupportedVersion, header.Version)
+}
+
+/*
+Writes every entry in the tree to w using the versioned snapshot format.
+*/
+func (self *tree) Snapshot(w io.Writer, codec Codec) error {
+	header := snapshotHeader{
+		Version:       snapshotVersion,
+		MaxDimensions: uint32(self.maxDimensions),
+		Duplicates:    uint8(self.options.Duplicates),
+		NumEntries:    uint64(self.numChildren),
+	}
+	copy(header.Magic[:], snapshotMagic)
+
+	if err := binary.Write(w, binary.BigEndian, &header); err != nil {
+		return err
+	}
+
+	var err error
+	self.all(func(entry r.Entry) bool {
+		var data []byte
+		data, err = codec.Encode(entry)
+		if err != nil {
+			return false
+		}
+
+		err = binary.Write(w, binary.BigEndian, uint32(len(data)))
+		if err != nil {
+			return false
+		}
+
+		_, err = w.Write(data)
+		return err == nil
+	})
+
+	return err
+}
+
+/*
+Reads a tree written by Snapshot.  The tree is rebuilt directly from the
+sorted stream in time linear in the number of entries.
+*/
+func Restore(rd io.Reader, codec Codec) (*tree, error) {
+	return RestoreWithOptions(rd, codec, Options{})
+}
+
+/*
+Restore with options for the rebuilt tree.  options.Duplicates must match
+the mode the snapshot was written with, so a multiset snapshot must be
+restored as a multiset.  Entry lengths are not trusted, each payload is
+read as it arrives rather than allocated up front.
+*/
+func RestoreWithOptions(rd io.Reader, codec Codec, options Options) (*tree, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	var header snapshotHeader
+	hasMode, err := readHeader(rd, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasMode && r.DuplicateMode(header.Duplicates) != options.Duplicates {
+		return nil, fmt.Errorf(
+			`%w: written in %s mode, restoring as %s`,
+			ErrInvalidSnapshot, r.DuplicateMode(header.Duplicates), options.Duplicates,
+		)
+	}
+
+	maxDimensions := int(header.MaxDimensions)
+	last := 0 // the comparison allowed between an entry and the one before
+	if options.Duplicates == r.Multiset {
+		last = 1
+	}
+
+	entries := make([]r.Entry, 0)
+	var data bytes.Buffer
+
+	for i := uint64(0); i < header.NumEntries; i++ {
+		var length uint32
+		if err := binary.Read(rd, binary.BigEndian, &length); err != nil {
+			return nil, fmt.Errorf(`%w: reading entry %d: %v`, ErrInvalidSnapshot, i, err)
+		}
+
+		data.Reset()
+		if _, err := io.CopyN(&data, rd, int64(length)); err != nil {
+			return nil, fmt.Errorf(`%w: reading entry %d: %v`, ErrInvalidSnapshot, i, err)
+		}
+
+		entry, err := codec.Decode(data.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		if entry == nil || entry.MaxDimensions() != maxDimensions {
+			return nil, fmt.Errorf(`%w: entry %d has the wrong dimensions`, ErrInvalidSnapshot, i)
+		}
+
+		if len(entries) > 0 && r.Compare(entries[len(entries)-1], entry, maxDimensions) >= last {
+			return nil, fmt.Errorf(`%w: entry %d out of order`, ErrInvalidSnapshot, i)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return newSorted(&options, maxDimensions, 1, entries), nil
+}
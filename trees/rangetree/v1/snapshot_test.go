@@ -0,0 +1,202 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+type pointCodec struct{}
+
+func (pointCodec) Encode(entry r.Entry) ([]byte, error) {
+	data := make([]byte, 0, 2*binary.MaxVarintLen64)
+	data = binary.AppendVarint(data, int64(entry.GetDimensionalValue(1)))
+	return binary.AppendVarint(data, int64(entry.GetDimensionalValue(2))), nil
+}
+
+func (pointCodec) Decode(data []byte) (r.Entry, error) {
+	x, n := binary.Varint(data)
+	y, _ := binary.Varint(data[n:])
+	return newPoint(int(x), int(y)), nil
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	points := randomPoints(rnd, 200, 25)
+
+	tree := New(2)
+	for _, p := range points {
+		tree.Insert(p)
+	}
+
+	var buf bytes.Buffer
+	if err := tree.Snapshot(&buf, pointCodec{}); err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	restored, err := Restore(&buf, pointCodec{})
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	if restored.Len() != tree.Len() {
+		t.Errorf(`Expected len: %d, received: %d`, tree.Len(), restored.Len())
+	}
+
+	checkTreeCounts(t, restored)
+	checkRandomCounts(t, rnd, restored, points, 25)
+}
+
+func TestSnapshotEmptyTree(t *testing.T) {
+	tree := New(2, newPoint(0, 0))
+	tree.Clear()
+
+	var buf bytes.Buffer
+	if err := tree.Snapshot(&buf, pointCodec{}); err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	restored, err := Restore(&buf, pointCodec{})
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	if restored.Len() != 0 || restored.root != nil {
+		t.Errorf(`Expected empty tree, received: %+v`, restored)
+	}
+}
+
+func TestSnapshotMultiset(t *testing.T) {
+	options := Options{Duplicates: r.Multiset}
+	tree := NewWithOptions(2, options, newPoint(0, 0), newPoint(1, 1), newPoint(1, 1))
+
+	var buf bytes.Buffer
+	if err := tree.Snapshot(&buf, pointCodec{}); err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+	data := buf.Bytes()
+
+	if _, err := Restore(bytes.NewReader(data), pointCodec{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf(`Expected invalid snapshot, received: %v`, err)
+	}
+
+	restored, err := RestoreWithOptions(bytes.NewReader(data), pointCodec{}, options)
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkTreeCounts(t, restored)
+	checkLen(t, restored.Get(1, 1), 2)
+}
+
+func TestRestoreRejectsBadInput(t *testing.T) {
+	var buf bytes.Buffer
+	New(2, newPoint(0, 0), newPoint(1, 1)).Snapshot(&buf, pointCodec{})
+	data := buf.Bytes()
+
+	_, err := Restore(bytes.NewReader([]byte(`nope`)), pointCodec{})
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf(`Expected invalid snapshot, received: %v`, err)
+	}
+
+	bad := append([]byte{}, data...)
+	bad[0] = 'X'
+	_, err = Restore(bytes.NewReader(bad), pointCodec{})
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf(`Expected invalid snapshot, received: %v`, err)
+	}
+
+	bad = append([]byte{}, data...)
+	bad[5] = snapshotVersion + 1
+	_, err = Restore(bytes.NewReader(bad), pointCodec{})
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf(`Expected unsupported version, received: %v`, err)
+	}
+
+	_, err = Restore(bytes.NewReader(data[0:len(data)-1]), pointCodec{})
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf(`Expected invalid snapshot, received: %v`, err)
+	}
+}
+
+func TestRestoreRejectsUnsortedEntries(t *testing.T) {
+	var buf bytes.Buffer
+	header := snapshotHeader{Version: snapshotVersion, MaxDimensions: 2, NumEntries: 2}
+	copy(header.Magic[:], snapshotMagic)
+	binary.Write(&buf, binary.BigEndian, &header)
+
+	for _, p := range []*point{newPoint(1, 1), newPoint(0, 0)} {
+		data, _ := pointCodec{}.Encode(p)
+		binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	_, err := Restore(&buf, pointCodec{})
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf(`Expected invalid snapshot, received: %v`, err)
+	}
+}
+
+func TestRestoreChecksDuplicateMode(t *testing.T) {
+	var buf bytes.Buffer
+	NewWithOptions(2, Options{Duplicates: r.Set}, newPoint(0, 0)).Snapshot(&buf, pointCodec{})
+	data := buf.Bytes()
+
+	for _, mode := range []r.DuplicateMode{r.Replace, r.Multiset} {
+		_, err := RestoreWithOptions(bytes.NewReader(data), pointCodec{}, Options{Duplicates: mode})
+		if !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf(`%s: expected invalid snapshot, received: %v`, mode, err)
+		}
+	}
+
+	if _, err := RestoreWithOptions(bytes.NewReader(data), pointCodec{}, Options{Duplicates: r.Set}); err != nil {
+		t.Errorf(`Unexpected error: %v`, err)
+	}
+}
+
+func TestRestoreVersion1(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	binary.Write(&buf, binary.BigEndian, uint16(1))
+	binary.Write(&buf, binary.BigEndian, &snapshotHeaderV1{MaxDimensions: 2, NumEntries: 2})
+
+	for _, p := range []*point{newPoint(0, 0), newPoint(1, 1)} {
+		data, _ := pointCodec{}.Encode(p)
+		binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	restored, err := Restore(&buf, pointCodec{})
+	if err != nil {
+		t.Fatalf(`Unexpected error: %v`, err)
+	}
+
+	checkLen(t, restored.All(), 2)
+}
+
+func TestRestoreDoesNotTrustLengths(t *testing.T) {
+	var buf bytes.Buffer
+	header := snapshotHeader{Version: snapshotVersion, MaxDimensions: 2, NumEntries: 1}
+	copy(header.Magic[:], snapshotMagic)
+	binary.Write(&buf, binary.BigEndian, &header)
+	binary.Write(&buf, binary.BigEndian, uint32(1<<32-1))
+	buf.WriteString(`short`)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	_, err := Restore(&buf, pointCodec{})
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf(`Expected invalid snapshot, received: %v`, err)
+	}
+
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf(`Expected a small allocation for a short payload, received: %d bytes`, allocated)
+	}
+}
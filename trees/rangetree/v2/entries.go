@@ -0,0 +1,128 @@
+package v2
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+/*
+Entry holds the coordinates of a point, one key per dimension starting at
+dimension 1, and the payload stored at that point.
+*/
+type Entry[K cmp.Ordered, V any] struct {
+	Coordinates []K
+	Value       V
+}
+
+func NewEntry[K cmp.Ordered, V any](value V, coordinates ...K) Entry[K, V] {
+	return Entry[K, V]{
+		Coordinates: coordinates,
+		Value:       value,
+	}
+}
+
+/*
+Returns the key of this entry in the given dimension, dimensions start
+at 1 to match v1.
+*/
+func (self Entry[K, V]) GetDimensionalValue(dimension int) K {
+	return self.Coordinates[dimension-1]
+}
+
+func (self Entry[K, V]) MaxDimensions() int {
+	return len(self.Coordinates)
+}
+
+/*
+returns an error wrapping rangetree.ErrDimensionMismatch if any entry
+does not have exactly maxDimensions coordinates
+*/
+func validateEntries[K cmp.Ordered, V any](maxDimensions int, entries []Entry[K, V]) error {
+	for i, entry := range entries {
+		if entry.MaxDimensions() != maxDimensions {
+			return fmt.Errorf(
+				`%w: entry %d has %d dimensions, the tree has %d`,
+				r.ErrDimensionMismatch, i, entry.MaxDimensions(), maxDimensions,
+			)
+		}
+	}
+
+	return nil
+}
+
+/*
+compares two entries on every dimension from the given dimension to the
+last, the order the nested trees expect their entries in
+*/
+func compareFrom[K cmp.Ordered, V any](dimension int) func(a, b Entry[K, V]) int {
+	return func(a, b Entry[K, V]) int {
+		for i := dimension - 1; i < len(a.Coordinates); i++ {
+			if c := cmp.Compare(a.Coordinates[i], b.Coordinates[i]); c != 0 {
+				return c
+			}
+		}
+
+		return 0
+	}
+}
+
+/*
+returns a sorted copy of the entries, the caller's slice is left alone.
+The sort is stable so later entries with the same coordinates win.
+*/
+func sortEntries[K cmp.Ordered, V any](entries []Entry[K, V], dimension int) []Entry[K, V] {
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, compareFrom[K, V](dimension))
+	return sorted
+}
+
+/*
+a run of sorted entries sharing the same key in one dimension
+*/
+type group[K cmp.Ordered, V any] struct {
+	value   K
+	entries []Entry[K, V]
+}
+
+/*
+groups entries, which must be sorted from this dimension on, by their key
+in this dimension
+*/
+func groupEntries[K cmp.Ordered, V any](entries []Entry[K, V], dimension int) []group[K, V] {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	groups := make([]group[K, V], 0)
+	lastIndex := 0
+	lastSeen := entries[0].GetDimensionalValue(dimension)
+
+	for i := 1; i < len(entries); i++ {
+		value := entries[i].GetDimensionalValue(dimension)
+		if cmp.Compare(value, lastSeen) == 0 {
+			continue
+		}
+
+		groups = append(groups, group[K, V]{lastSeen, entries[lastIndex:i]})
+		lastIndex = i
+		lastSeen = value
+	}
+
+	return append(groups, group[K, V]{lastSeen, entries[lastIndex:]})
+}
+
+/*
+returns the index of the first group whose key is not less than value
+*/
+func findGroup[K cmp.Ordered, V any](groups []group[K, V], value K) int {
+	index, _ := slices.BinarySearchFunc(
+		groups, value, func(g group[K, V], value K) int {
+			return cmp.Compare(g.value, value)
+		},
+	)
+
+	return index
+}
@@ -0,0 +1,50 @@
+package v2
+
+import "testing"
+
+func TestSortEntriesLexicographic(t *testing.T) {
+	entries := []Entry[int, string]{
+		NewEntry(`c`, 1, 0),
+		NewEntry(`b`, 0, 1),
+		NewEntry(`d`, 1, 1),
+		NewEntry(`a`, 0, 0),
+	}
+
+	sorted := sortEntries(entries, 1)
+
+	for i, expected := range []string{`a`, `b`, `c`, `d`} {
+		if sorted[i].Value != expected {
+			t.Errorf(`Expected value: %s, received: %s`, expected, sorted[i].Value)
+		}
+	}
+}
+
+func TestGroupEntries(t *testing.T) {
+	entries := sortEntries([]Entry[int, string]{
+		NewEntry(`a`, 0, 0),
+		NewEntry(`b`, 0, 1),
+		NewEntry(`c`, 2, 1),
+	}, 1)
+
+	groups := groupEntries(entries, 1)
+
+	if len(groups) != 2 {
+		t.Fatalf(`Expected len: %d, received: %d`, 2, len(groups))
+	}
+
+	if groups[0].value != 0 || len(groups[0].entries) != 2 {
+		t.Errorf(`Expected group at 0 with 2 entries, received: %+v`, groups[0])
+	}
+
+	if groups[1].value != 2 || len(groups[1].entries) != 1 {
+		t.Errorf(`Expected group at 2 with 1 entry, received: %+v`, groups[1])
+	}
+
+	if index := findGroup(groups, 1); index != 1 {
+		t.Errorf(`Expected index: %d, received: %d`, 1, index)
+	}
+
+	if groups := groupEntries[int, string](nil, 1); groups != nil {
+		t.Errorf(`Expected nil groups, received: %+v`, groups)
+	}
+}
@@ -0,0 +1,591 @@
+/*
+Package v2 is a generic version of the v1 range tree.  Keys may be any
+ordered type and every entry carries a typed payload.  Entries are ordered
+with cmp.Compare so callers no longer write their own Less, queries keep
+the [Low, High) semantics of v1 and entries with identical coordinates
+replace one another.
+*/
+package v2
+
+import (
+	"cmp"
+	"iter"
+)
+
+/*
+[Low, High) Houses the high/low values for a query in one dimension
+*/
+type Bounds[K cmp.Ordered] struct {
+	Low  K
+	High K
+}
+
+func NewBounds[K cmp.Ordered](low, high K) Bounds[K] {
+	return Bounds[K]{Low: low, High: high}
+}
+
+func (self Bounds[K]) contains(value K) bool {
+	return cmp.Compare(value, self.Low) >= 0 && cmp.Compare(value, self.High) < 0
+}
+
+/*
+Query holds one Bounds per dimension, the first element bounds dimension 1
+*/
+type Query[K cmp.Ordered] []Bounds[K]
+
+func NewQuery[K cmp.Ordered](bounds ...Bounds[K]) Query[K] {
+	return Query[K](bounds)
+}
+
+func (self Query[K]) GetDimensionalBounds(dimension int) Bounds[K] {
+	return self[dimension-1]
+}
+
+type RangeTree[K cmp.Ordered, V any] interface {
+	/*
+		Removes the entries, panics if one has the wrong number of
+		coordinates.
+	*/
+	Remove(entries ...Entry[K, V])
+	/*
+		Validates the entries before removing any of them, returning an
+		error wrapping rangetree.ErrDimensionMismatch.
+	*/
+	RemoveChecked(entries ...Entry[K, V]) error
+	GetRange(query Query[K]) []Entry[K, V]
+	/*
+		Calls fn with every entry that falls within the query, stopping
+		as soon as fn returns false.
+	*/
+	Range(query Query[K], fn func(Entry[K, V]) bool)
+	Iter(query Query[K]) iter.Seq[Entry[K, V]]
+	Count(query Query[K]) int
+	/*
+		Inserts the entries, panics if one has the wrong number of
+		coordinates.
+	*/
+	Insert(entries ...Entry[K, V])
+	/*
+		Validates the entries before inserting any of them, returning an
+		error wrapping rangetree.ErrDimensionMismatch.
+	*/
+	InsertChecked(entries ...Entry[K, V]) error
+	Copy() RangeTree[K, V]
+	Clear()
+	Len() int
+	All() []Entry[K, V]
+}
+
+type node[K cmp.Ordered, V any] struct {
+	left        *node[K, V]
+	right       *node[K, V]
+	entry       Entry[K, V]
+	value       K
+	numChildren int
+	rt          *tree[K, V]
+}
+
+func newNode[K cmp.Ordered, V any](tree *tree[K, V], groups []group[K, V]) *node[K, V] {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	if len(groups) == 1 {
+		n := &node[K, V]{value: groups[0].value}
+		if tree.isLastDimension() { // the last entry wins for duplicates
+			n.entry = groups[0].entries[len(groups[0].entries)-1]
+		} else {
+			n.rt = new(tree.maxDimensions, tree.dimension+1, groups[0].entries)
+		}
+
+		return n
+	}
+
+	median := len(groups) / 2
+
+	return &node[K, V]{
+		left:        newNode(tree, groups[0:median]),
+		right:       newNode(tree, groups[median:]),
+		value:       groups[median].value,
+		numChildren: len(groups),
+	}
+}
+
+func (self *node[K, V]) isLeaf() bool {
+	return self.left == nil
+}
+
+/*
+returns the number of leaves this node contributes to its parent's
+numChildren, a leaf counts as one
+*/
+func (self *node[K, V]) size() int {
+	if self.isLeaf() {
+		return 1
+	}
+
+	return self.numChildren
+}
+
+func (self *node[K, V]) numEntries() int {
+	if self.isLeaf() {
+		if self.rt == nil {
+			return 1
+		}
+
+		return self.rt.numChildren
+	}
+
+	return self.left.numEntries() + self.right.numEntries()
+}
+
+func (self *node[K, V]) setChildren(left, right *node[K, V]) {
+	self.left, self.right = left, right
+	self.numChildren = left.size() + right.size()
+}
+
+func (self *node[K, V]) all(fn func(Entry[K, V]) bool) bool {
+	if self.isLeaf() {
+		if self.rt == nil {
+			return fn(self.entry)
+		}
+
+		return self.rt.all(fn)
+	}
+
+	return self.left.all(fn) && self.right.all(fn)
+}
+
+/*
+visits every entry below this node that falls within the query.  left is
+true when every key below this node is under the high bound and right is
+true when every key is at or above the low bound.
+*/
+func (self *node[K, V]) getRange(tree *tree[K, V], query Query[K], fn func(Entry[K, V]) bool, left, right bool) bool {
+	bounds := query.GetDimensionalBounds(tree.dimension)
+	if self.isLeaf() {
+		if !bounds.contains(self.value) {
+			return true
+		}
+
+		if self.rt == nil {
+			return fn(self.entry)
+		}
+
+		return self.rt.getRange(query, fn)
+	}
+
+	if cmp.Compare(bounds.High, self.value) <= 0 {
+		return self.left.getRange(tree, query, fn, left, right)
+	}
+
+	if cmp.Compare(bounds.Low, self.value) > 0 {
+		return self.right.getRange(tree, query, fn, left, right)
+	}
+
+	if left {
+		return self.left.getRange(tree, query, fn, true, false) &&
+			self.right.flatten(query, fn)
+	} else if right {
+		return self.left.flatten(query, fn) &&
+			self.right.getRange(tree, query, fn, false, true)
+	}
+
+	return self.left.getRange(tree, query, fn, true, false) &&
+		self.right.getRange(tree, query, fn, false, true)
+}
+
+/*
+visits every entry below a node whose keys all fall within the query in
+this dimension
+*/
+func (self *node[K, V]) flatten(query Query[K], fn func(Entry[K, V]) bool) bool {
+	if self.isLeaf() {
+		if self.rt == nil {
+			return fn(self.entry)
+		}
+
+		return self.rt.getRange(query, fn)
+	}
+
+	return self.left.flatten(query, fn) && self.right.flatten(query, fn)
+}
+
+func (self *node[K, V]) count(tree *tree[K, V], query Query[K], left, right bool) int {
+	bounds := query.GetDimensionalBounds(tree.dimension)
+	if self.isLeaf() {
+		if !bounds.contains(self.value) {
+			return 0
+		}
+
+		if self.rt == nil {
+			return 1
+		}
+
+		return self.rt.count(query)
+	}
+
+	if cmp.Compare(bounds.High, self.value) <= 0 {
+		return self.left.count(tree, query, left, right)
+	}
+
+	if cmp.Compare(bounds.Low, self.value) > 0 {
+		return self.right.count(tree, query, left, right)
+	}
+
+	if left {
+		return self.left.count(tree, query, true, false) +
+			self.right.countCovered(tree, query)
+	} else if right {
+		return self.left.countCovered(tree, query) +
+			self.right.count(tree, query, false, true)
+	}
+
+	return self.left.count(tree, query, true, false) +
+		self.right.count(tree, query, false, true)
+}
+
+func (self *node[K, V]) countCovered(tree *tree[K, V], query Query[K]) int {
+	if tree.isLastDimension() {
+		return self.size()
+	}
+
+	if self.isLeaf() {
+		return self.rt.count(query)
+	}
+
+	return self.left.countCovered(tree, query) +
+		self.right.countCovered(tree, query)
+}
+
+/*
+inserts the groups below this node, returns the number of leaves added to
+this dimension and the number of entries added overall
+*/
+func (self *node[K, V]) insert(tree *tree[K, V], groups []group[K, V]) (int, int) {
+	if len(groups) == 0 {
+		return 0, 0
+	}
+
+	index := findGroup(groups, self.value)
+
+	if !self.isLeaf() {
+		leftLeaves, leftEntries := self.left.insert(tree, groups[0:index])
+		rightLeaves, rightEntries := self.right.insert(tree, groups[index:])
+
+		self.numChildren += leftLeaves + rightLeaves
+		return leftLeaves + rightLeaves, leftEntries + rightEntries
+	}
+
+	low, high := groups[0:index], groups[index:]
+	added := 0
+
+	if len(high) > 0 && cmp.Compare(high[0].value, self.value) == 0 {
+		if tree.isLastDimension() {
+			self.entry = high[0].entries[len(high[0].entries)-1]
+		} else {
+			added += self.rt.insert(high[0].entries)
+		}
+
+		high = high[1:]
+	}
+
+	lowN, highN := newNode(tree, low), newNode(tree, high)
+	if lowN == nil && highN == nil {
+		return 0, added
+	}
+
+	leaf := &node[K, V]{
+		value: self.value,
+		entry: self.entry,
+		rt:    self.rt,
+	}
+
+	self.entry = Entry[K, V]{}
+	self.rt = nil
+
+	leaves := 0
+	switch {
+	case highN == nil:
+		self.setChildren(lowN, leaf)
+		leaves, added = lowN.size(), added+lowN.numEntries()
+	case lowN == nil:
+		self.value = high[0].value
+		self.setChildren(leaf, highN)
+		leaves, added = highN.size(), added+highN.numEntries()
+	default:
+		right := &node[K, V]{value: high[0].value}
+		right.setChildren(leaf, highN)
+		self.setChildren(lowN, right)
+		leaves = lowN.size() + highN.size()
+		added += lowN.numEntries() + highN.numEntries()
+	}
+
+	return leaves, added
+}
+
+/*
+removes the entry with matching coordinates below this node.  Returns the
+node that should take this node's place, nil if it is now empty, and
+whether anything was removed.
+*/
+func (self *node[K, V]) remove(tree *tree[K, V], entry Entry[K, V]) (*node[K, V], bool) {
+	value := entry.GetDimensionalValue(tree.dimension)
+
+	if self.isLeaf() {
+		if cmp.Compare(self.value, value) != 0 {
+			return self, false
+		}
+
+		if self.rt == nil {
+			return nil, true
+		}
+
+		if !self.rt.remove(entry) {
+			return self, false
+		}
+
+		if self.rt.numChildren == 0 {
+			return nil, true
+		}
+
+		return self, true
+	}
+
+	var removed bool
+	if cmp.Compare(value, self.value) >= 0 {
+		self.right, removed = self.right.remove(tree, entry)
+	} else {
+		self.left, removed = self.left.remove(tree, entry)
+	}
+
+	// a child emptied out, its sibling takes our place
+	if self.left == nil {
+		return self.right, removed
+	} else if self.right == nil {
+		return self.left, removed
+	}
+
+	self.numChildren = self.left.size() + self.right.size()
+	return self, removed
+}
+
+func (self *node[K, V]) copy() *node[K, V] {
+	cp := &node[K, V]{
+		entry:       self.entry,
+		value:       self.value,
+		numChildren: self.numChildren,
+	}
+
+	if self.rt != nil {
+		cp.rt = self.rt.copy()
+	}
+
+	if self.isLeaf() {
+		return cp
+	}
+
+	cp.left = self.left.copy()
+	cp.right = self.right.copy()
+	return cp
+}
+
+type tree[K cmp.Ordered, V any] struct {
+	root          *node[K, V]
+	dimension     int
+	maxDimensions int
+	numChildren   int
+}
+
+func (self *tree[K, V]) isLastDimension() bool {
+	return self.dimension >= self.maxDimensions
+}
+
+func (self *tree[K, V]) all(fn func(Entry[K, V]) bool) bool {
+	if self.root == nil {
+		return true
+	}
+
+	return self.root.all(fn)
+}
+
+func (self *tree[K, V]) All() []Entry[K, V] {
+	entries := make([]Entry[K, V], 0, self.numChildren)
+	self.all(func(entry Entry[K, V]) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+func (self *tree[K, V]) getRange(query Query[K], fn func(Entry[K, V]) bool) bool {
+	if self.root == nil {
+		return true
+	}
+
+	return self.root.getRange(self, query, fn, false, false)
+}
+
+func (self *tree[K, V]) GetRange(query Query[K]) []Entry[K, V] {
+	entries := []Entry[K, V]{}
+
+	self.getRange(query, func(entry Entry[K, V]) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+func (self *tree[K, V]) Range(query Query[K], fn func(Entry[K, V]) bool) {
+	self.getRange(query, fn)
+}
+
+func (self *tree[K, V]) Iter(query Query[K]) iter.Seq[Entry[K, V]] {
+	return func(yield func(Entry[K, V]) bool) {
+		self.getRange(query, yield)
+	}
+}
+
+func (self *tree[K, V]) count(query Query[K]) int {
+	if self.root == nil {
+		return 0
+	}
+
+	return self.root.count(self, query, false, false)
+}
+
+func (self *tree[K, V]) Count(query Query[K]) int {
+	return self.count(query)
+}
+
+/*
+inserts entries sorted from this dimension on, returns the number of
+entries added
+*/
+func (self *tree[K, V]) insert(entries []Entry[K, V]) int {
+	groups := groupEntries(entries, self.dimension)
+
+	var added int
+	if self.root == nil {
+		self.root = newNode(self, groups)
+		if self.root != nil {
+			added = self.root.numEntries()
+		}
+	} else {
+		_, added = self.root.insert(self, groups)
+	}
+
+	self.numChildren += added
+	return added
+}
+
+func (self *tree[K, V]) Insert(entries ...Entry[K, V]) {
+	if err := self.InsertChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *tree[K, V]) InsertChecked(entries ...Entry[K, V]) error {
+	if err := validateEntries(self.maxDimensions, entries); err != nil {
+		return err
+	}
+
+	self.insert(sortEntries(entries, self.dimension))
+	return nil
+}
+
+func (self *tree[K, V]) remove(entry Entry[K, V]) bool {
+	if self.root == nil {
+		return false
+	}
+
+	var removed bool
+	self.root, removed = self.root.remove(self, entry)
+	if removed {
+		self.numChildren--
+	}
+
+	return removed
+}
+
+func (self *tree[K, V]) Remove(entries ...Entry[K, V]) {
+	if err := self.RemoveChecked(entries...); err != nil {
+		panic(err)
+	}
+}
+
+func (self *tree[K, V]) RemoveChecked(entries ...Entry[K, V]) error {
+	if err := validateEntries(self.maxDimensions, entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		self.remove(entry)
+	}
+
+	return nil
+}
+
+func (self *tree[K, V]) Len() int {
+	return self.numChildren
+}
+
+func (self *tree[K, V]) copy() *tree[K, V] {
+	cp := &tree[K, V]{
+		dimension:     self.dimension,
+		maxDimensions: self.maxDimensions,
+		numChildren:   self.numChildren,
+	}
+
+	if self.root != nil {
+		cp.root = self.root.copy()
+	}
+
+	return cp
+}
+
+func (self *tree[K, V]) Copy() RangeTree[K, V] {
+	return self.copy()
+}
+
+func (self *tree[K, V]) Clear() {
+	self.root = nil
+	self.numChildren = 0
+}
+
+func new[K cmp.Ordered, V any](maxDimensions, dimension int, entries []Entry[K, V]) *tree[K, V] {
+	t := &tree[K, V]{
+		maxDimensions: maxDimensions,
+		dimension:     dimension,
+	}
+
+	t.insert(entries)
+	return t
+}
+
+/*
+Builds a tree over the given entries.  The caller's slice is not modified.
+Panics if an entry has the wrong number of coordinates.
+*/
+func New[K cmp.Ordered, V any](maxDimensions int, entries ...Entry[K, V]) *tree[K, V] {
+	t, err := NewChecked(maxDimensions, entries...)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+/*
+Builds a tree like New, returning an error wrapping
+rangetree.ErrDimensionMismatch instead of panicking.
+*/
+func NewChecked[K cmp.Ordered, V any](maxDimensions int, entries ...Entry[K, V]) (*tree[K, V], error) {
+	if err := validateEntries(maxDimensions, entries); err != nil {
+		return nil, err
+	}
+
+	return new(maxDimensions, 1, sortEntries(entries, 1)), nil
+}
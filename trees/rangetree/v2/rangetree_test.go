@@ -0,0 +1,262 @@
+package v2
+
+import (
+	"cmp"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	r "github.com/dzyp/data/trees/rangetree"
+)
+
+type timestamp int64
+
+func checkLen[K cmp.Ordered, V any](t *testing.T, entries []Entry[K, V], expected int) {
+	if len(entries) != expected {
+		t.Errorf(`Expected len: %d, received: %d`, expected, len(entries))
+	}
+}
+
+func checkValues[K cmp.Ordered, V comparable](t *testing.T, entries []Entry[K, V], expected ...V) {
+	checkLen(t, entries, len(expected))
+
+	for _, value := range expected {
+		found := false
+		for _, entry := range entries {
+			if entry.Value == value {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf(`Expected: %+v, not found.`, value)
+		}
+	}
+}
+
+func checkTreeCounts[K cmp.Ordered, V any](t *testing.T, tree *tree[K, V]) {
+	var walk func(n *node[K, V]) int
+	walk = func(n *node[K, V]) int {
+		if n.isLeaf() {
+			if n.rt != nil {
+				checkTreeCounts(t, n.rt)
+			}
+			return 1
+		}
+
+		leaves := walk(n.left) + walk(n.right)
+		if n.numChildren != leaves {
+			t.Errorf(`Expected num children: %d, received: %d`, leaves, n.numChildren)
+		}
+		return leaves
+	}
+
+	if tree.root != nil {
+		walk(tree.root)
+	}
+
+	if entries := len(tree.All()); entries != tree.numChildren {
+		t.Errorf(`Expected len: %d, received: %d`, entries, tree.numChildren)
+	}
+}
+
+func TestInsertAndQueryInts(t *testing.T) {
+	tree := New[int64, string](2)
+
+	tree.Insert(
+		NewEntry[int64](`a`, 0, 0),
+		NewEntry[int64](`b`, 1, 1),
+		NewEntry[int64](`c`, 5, 5),
+		NewEntry[int64](`d`, 9, 9),
+	)
+
+	entries := tree.GetRange(NewQuery(NewBounds[int64](1, 9), NewBounds[int64](0, 10)))
+	checkValues(t, entries, `b`, `c`)
+
+	if count := tree.Count(NewQuery(NewBounds[int64](0, 10), NewBounds[int64](0, 10))); count != 4 {
+		t.Errorf(`Expected count: %d, received: %d`, 4, count)
+	}
+}
+
+func TestFloatKeys(t *testing.T) {
+	tree := New(2,
+		NewEntry(1, .5, .5),
+		NewEntry(2, .25, .75),
+		NewEntry(3, 1.5, .1),
+	)
+
+	entries := tree.GetRange(NewQuery(NewBounds(0., 1.), NewBounds(.6, 1.)))
+	checkValues(t, entries, 2)
+}
+
+func TestTimeLikeKeys(t *testing.T) {
+	now := timestamp(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Unix())
+	hour := timestamp(time.Hour / time.Second)
+
+	tree := New[timestamp, string](1)
+	tree.Insert(
+		NewEntry(`early`, now),
+		NewEntry(`later`, now+hour),
+		NewEntry(`latest`, now+2*hour),
+	)
+
+	entries := tree.GetRange(NewQuery(NewBounds(now+hour, now+3*hour)))
+	checkValues(t, entries, `later`, `latest`)
+}
+
+func TestStringKeys(t *testing.T) {
+	tree := New(2,
+		NewEntry(1, `apple`, `red`),
+		NewEntry(2, `banana`, `yellow`),
+		NewEntry(3, `cherry`, `red`),
+	)
+
+	entries := tree.GetRange(NewQuery(NewBounds(`a`, `c`), NewBounds(`r`, `s`)))
+	checkValues(t, entries, 1)
+}
+
+func TestDuplicateCoordinatesReplace(t *testing.T) {
+	tree := New(2, NewEntry(`first`, 1, 1))
+	tree.Insert(NewEntry(`second`, 1, 1))
+
+	checkValues(t, tree.All(), `second`)
+
+	if tree.Len() != 1 {
+		t.Errorf(`Expected len: %d, received: %d`, 1, tree.Len())
+	}
+
+	tree = New(2, NewEntry(`first`, 1, 1), NewEntry(`second`, 1, 1))
+	checkValues(t, tree.All(), `second`)
+}
+
+func TestNewDoesNotSortCallerSlice(t *testing.T) {
+	entries := []Entry[int, int]{NewEntry(0, 2), NewEntry(1, 1), NewEntry(2, 0)}
+
+	New(1, entries...)
+
+	for i, entry := range entries {
+		if entry.Value != i {
+			t.Errorf(`Expected value: %d, received: %d`, i, entry.Value)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tree := New(2,
+		NewEntry(`a`, 0, 0),
+		NewEntry(`b`, 0, 1),
+		NewEntry(`c`, 1, 1),
+	)
+
+	tree.Remove(NewEntry(``, 0, 1), NewEntry(``, 5, 5))
+
+	checkValues(t, tree.All(), `a`, `c`)
+	checkTreeCounts(t, tree)
+
+	tree.Remove(NewEntry(``, 0, 0), NewEntry(``, 1, 1))
+
+	if tree.root != nil {
+		t.Errorf(`Expected nil root, received: %+v`, tree.root)
+	}
+	checkTreeCounts(t, tree)
+}
+
+func TestDimensionMismatch(t *testing.T) {
+	tree := New(2, NewEntry(`a`, 0, 0))
+
+	if err := tree.InsertChecked(NewEntry(`b`, 1, 1), NewEntry(`c`, 1)); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	if err := tree.RemoveChecked(NewEntry(``, 0, 0), NewEntry(``, 0, 0, 0)); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	if _, err := NewChecked(2, NewEntry(`d`, 1)); !errors.Is(err, r.ErrDimensionMismatch) {
+		t.Errorf(`Expected dimension mismatch, received: %v`, err)
+	}
+
+	// nothing is inserted or removed from a batch holding an invalid entry
+	checkValues(t, tree.All(), `a`)
+	if count := tree.Count(NewQuery(NewBounds(0, 2), NewBounds(0, 2))); count != 1 {
+		t.Errorf(`Expected count: %d, received: %d`, 1, count)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf(`Expected Insert to panic on a short entry.`)
+		}
+	}()
+	tree.Insert(NewEntry(`e`, 1))
+}
+
+func TestRangeStopsEarly(t *testing.T) {
+	tree := New(1, NewEntry(0, 0), NewEntry(1, 1), NewEntry(2, 2))
+
+	visited := 0
+	for range tree.Iter(NewQuery(NewBounds(0, 3))) {
+		visited++
+		break
+	}
+
+	if visited != 1 {
+		t.Errorf(`Expected visited: %d, received: %d`, 1, visited)
+	}
+}
+
+func TestCopyIsIndependent(t *testing.T) {
+	tree := New(2, NewEntry(`a`, 0, 0), NewEntry(`b`, 1, 1))
+
+	cp := tree.Copy()
+	tree.Remove(NewEntry(``, 0, 0))
+	tree.Clear()
+
+	checkValues(t, cp.All(), `a`, `b`)
+	if tree.Len() != 0 {
+		t.Errorf(`Expected len: %d, received: %d`, 0, tree.Len())
+	}
+}
+
+func TestMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	max := 20
+
+	points := make(map[[3]int]int)
+	tree := New[int, int](3)
+
+	for i := 0; i < 2000; i++ {
+		coords := [3]int{rnd.Intn(max), rnd.Intn(max), rnd.Intn(max)}
+		entry := NewEntry(i, coords[0], coords[1], coords[2])
+		if rnd.Intn(3) == 0 {
+			tree.Remove(entry)
+			delete(points, coords)
+		} else {
+			tree.Insert(entry)
+			points[coords] = i
+		}
+	}
+
+	checkTreeCounts(t, tree)
+
+	for i := 0; i < 100; i++ {
+		q := make(Query[int], 3)
+		for d := range q {
+			low := rnd.Intn(max)
+			q[d] = NewBounds(low, low+rnd.Intn(max))
+		}
+
+		expected := make([]int, 0)
+		for coords, value := range points {
+			if q[0].contains(coords[0]) && q[1].contains(coords[1]) &&
+				q[2].contains(coords[2]) {
+				expected = append(expected, value)
+			}
+		}
+
+		checkValues(t, tree.GetRange(q), expected...)
+		if count := tree.Count(q); count != len(expected) {
+			t.Errorf(`Expected count: %d, received: %d`, len(expected), count)
+		}
+	}
+}